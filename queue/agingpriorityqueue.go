@@ -0,0 +1,91 @@
+package queue
+
+import (
+	"time"
+)
+
+// AgingPriorityQueue is an unbounded priority queue whose items gain
+// priority as they wait, so that a steady flow of items of high priority
+// does not starve the items of low priority. Items of equal priority are
+// popped in the order they were pushed. It is not safe for concurrent use.
+type AgingPriorityQueue[T any] struct {
+	pq       *PriorityQueue[aging[T]]
+	age      func(item T, waited time.Duration) T
+	interval time.Duration
+	agedAt   time.Time // when the items were last aged
+	now      func() time.Time
+}
+
+type aging[T any] struct {
+	item     T
+	pushedAt time.Time
+	aged     T // the item with the priority it had when last aged
+}
+
+// NewAgingPriorityQueue will allocate an AgingPriorityQueue.
+// Function comparePriority reports whether the element a has higher priority than the element b.
+// Function age returns the item with the priority it has after waiting in the
+// queue for the duration, which should not decrease as the duration grows,
+// e.g. by raising a priority field by one per second waited. Pop re-ages all
+// items, in O(n), once the interval has passed since they were last aged, so
+// that priorities lag behind by no more than the interval; with a zero
+// interval, every Pop re-ages them. The options, if any, are as for
+// NewPriorityQueueWithOptions, except that the queue is always stable.
+func NewAgingPriorityQueue[T any](comparePriority func(a, b T) bool, age func(item T, waited time.Duration) T, interval time.Duration, options ...PriorityQueueOptions) *AgingPriorityQueue[T] {
+	var opts PriorityQueueOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	opts.Stable = true
+	return &AgingPriorityQueue[T]{
+		pq: NewPriorityQueueWithOptions(func(a, b aging[T]) bool {
+			return comparePriority(a.aged, b.aged)
+		}, opts),
+		age:      age,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Push adds the item to the queue. It never fails.
+func (aq *AgingPriorityQueue[T]) Push(item T, timeout ...time.Duration) error {
+	return aq.pq.Push(aging[T]{item: item, pushedAt: aq.now(), aged: aq.age(item, 0)})
+}
+
+// Pop removes and returns the item with the highest aged priority,
+// or returns ErrEmpty if the queue is empty.
+func (aq *AgingPriorityQueue[T]) Pop(timeout ...time.Duration) (T, error) {
+	aq.reage()
+	a, err := aq.pq.Pop()
+	return a.item, err
+}
+
+// Peek returns the item that Pop would return without removing it,
+// or returns ErrEmpty if the queue is empty.
+func (aq *AgingPriorityQueue[T]) Peek() (T, error) {
+	aq.reage()
+	a, err := aq.pq.Peek()
+	return a.item, err
+}
+
+// reage ages the items again, if the interval has passed.
+func (aq *AgingPriorityQueue[T]) reage() {
+	now := aq.now()
+	if aq.pq.Empty() || now.Sub(aq.agedAt) < aq.interval {
+		return
+	}
+	aq.agedAt = now
+	aq.pq.heap.reorder(func(entry *pentry[aging[T]]) {
+		entry.value.aged = aq.age(entry.value.item, now.Sub(entry.value.pushedAt))
+	})
+}
+
+// Len returns the number of items in the queue.
+func (aq *AgingPriorityQueue[T]) Len() int {
+	return aq.pq.Len()
+}
+
+// Empty returns whether the queue is empty.
+func (aq *AgingPriorityQueue[T]) Empty() bool {
+	return aq.pq.Empty()
+}
@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type agingjob struct {
+	name     string
+	priority int
+}
+
+func newAgingJobQueue(interval time.Duration, backend HeapBackend) (*AgingPriorityQueue[agingjob], *time.Time) {
+	now := time.Unix(0, 0)
+	aq := NewAgingPriorityQueue(func(a, b agingjob) bool {
+		return a.priority > b.priority
+	}, func(item agingjob, waited time.Duration) agingjob {
+		item.priority += int(waited / time.Second)
+		return item
+	}, interval, PriorityQueueOptions{Backend: backend})
+	aq.now = func() time.Time { return now }
+	return aq, &now
+}
+
+func TestAgingPriorityQueue(t *testing.T) {
+	for _, backend := range heapBackends {
+		aq, now := newAgingJobQueue(0, backend)
+
+		_, err := aq.Pop()
+		assert.Equal(t, ErrEmpty, err)
+
+		aq.Push(agingjob{`low`, 0})
+		// a steady flow of high priority jobs, one per second
+		var names []string
+		for i := 0; i < 8; i++ {
+			aq.Push(agingjob{`high`, 5})
+			*now = now.Add(time.Second)
+			job, err := aq.Pop()
+			assert.Nil(t, err)
+			names = append(names, job.name)
+		}
+		// low catches up after 6 seconds, and wins the tie as the older one
+		assert.Equal(t, []string{`high`, `high`, `high`, `high`, `high`, `low`, `high`, `high`}, names)
+		assert.Equal(t, 1, aq.Len())
+	}
+}
+
+func TestAgingPriorityQueueInterval(t *testing.T) {
+	aq, now := newAgingJobQueue(10*time.Second, BinaryHeap)
+
+	aq.Push(agingjob{`low`, 0})
+	aq.Push(agingjob{`high`, 5})
+	assert.Equal(t, `high`, popValue[agingjob](t, aq).name)
+	*now = now.Add(8 * time.Second)
+	aq.Push(agingjob{`high`, 5})
+
+	// the priorities are not aged again before the interval has passed
+	*now = now.Add(time.Second)
+	job, err := aq.Peek()
+	assert.Nil(t, err)
+	assert.Equal(t, `high`, job.name)
+	*now = now.Add(time.Second)
+	job, err = aq.Peek()
+	assert.Nil(t, err)
+	assert.Equal(t, `low`, job.name)
+
+	assert.Equal(t, `low`, popValue[agingjob](t, aq).name)
+	assert.Equal(t, `high`, popValue[agingjob](t, aq).name)
+	assert.True(t, aq.Empty())
+	_, err = aq.Peek()
+	assert.Equal(t, ErrEmpty, err)
+}
+
+func TestAgingPriorityQueueReorder(t *testing.T) {
+	for _, backend := range heapBackends {
+		aq, now := newAgingJobQueue(time.Minute, backend)
+
+		r := rand.New(rand.NewSource(5))
+		var jobs []agingjob
+		for i := 0; i < 100; i++ {
+			job := agingjob{strconv.Itoa(i), r.Intn(50)}
+			aq.Push(job)
+			jobs = append(jobs, agingjob{job.name, job.priority + 100 - i})
+			*now = now.Add(time.Second)
+		}
+		sort.SliceStable(jobs, func(i, j int) bool {
+			return jobs[i].priority > jobs[j].priority
+		})
+
+		for _, job := range jobs {
+			assert.Equal(t, job.name, popValue[agingjob](t, aq).name)
+		}
+		assert.True(t, aq.Empty())
+	}
+}
@@ -0,0 +1,204 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BlockingPriorityQueue is a priority queue that is safe for concurrent use,
+// with the blocking Push and Pop of ChannelQueue and RingQueue.
+type BlockingPriorityQueue[T any] struct {
+	mutex    sync.Mutex
+	pq       *PriorityQueue[T]
+	capacity int
+	notEmpty chan struct{} // closed when an item is pushed, if anyone waits
+	notFull  chan struct{} // closed when an item is popped, if anyone waits
+	done     chan struct{}
+	closer   sync.Once
+}
+
+// NewBlockingPriorityQueue will allocate a BlockingPriorityQueue ordered by
+// comparePriority, as for NewPriorityQueue. If a positive capacity is
+// specified, the queue holds no more than capacity items.
+func NewBlockingPriorityQueue[T any](comparePriority func(a, b T) bool, capacity ...int) *BlockingPriorityQueue[T] {
+	bq := &BlockingPriorityQueue[T]{
+		done: make(chan struct{}),
+	}
+	if len(capacity) > 0 && capacity[0] > 0 {
+		bq.capacity = capacity[0]
+		bq.pq = NewPriorityQueue(comparePriority, capacity[0])
+	} else {
+		bq.pq = NewPriorityQueue(comparePriority)
+	}
+	return bq
+}
+
+// Push adds the item to the queue. If the queue is full, will block
+// until an item is popped from the queue. If a nonzero timeout is specified,
+// block no more than the timeout duration and return ErrTimeout. If timeout
+// is zero, immediately return ErrFull. If the queue is closed, return ErrClosed.
+func (bq *BlockingPriorityQueue[T]) Push(item T, timeout ...time.Duration) error {
+	return bq.push(context.Background(), item, timeout...)
+}
+
+// PushContext adds the item to the queue. If the queue is full, will block
+// until an item is popped from the queue or ctx is done, in which case
+// ctx.Err() is returned. If the queue is closed, return ErrClosed.
+func (bq *BlockingPriorityQueue[T]) PushContext(ctx context.Context, item T) error {
+	return bq.push(ctx, item)
+}
+
+func (bq *BlockingPriorityQueue[T]) push(ctx context.Context, item T, timeout ...time.Duration) error {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	bq.mutex.Lock()
+	for {
+		if bq.IsClosed() {
+			bq.mutex.Unlock()
+			return ErrClosed
+		}
+		if bq.capacity == 0 || bq.pq.Len() < bq.capacity {
+			bq.pq.Push(item)
+			broadcast(&bq.notEmpty)
+			bq.mutex.Unlock()
+			return nil
+		}
+		if len(timeout) > 0 && timeout[0] <= 0 {
+			bq.mutex.Unlock()
+			return ErrFull
+		}
+		if len(timeout) > 0 && timer == nil {
+			timer = time.NewTimer(timeout[0])
+		}
+
+		notFull := waitFor(&bq.notFull)
+		bq.mutex.Unlock()
+		if err := bq.wait(ctx, notFull, timer); err != nil {
+			return err
+		}
+		bq.mutex.Lock()
+	}
+}
+
+// Pop will return the item with the highest priority. If the queue is empty,
+// block until an item is pushed to the queue. If a nonzero timeout is specified,
+// block no more than the timeout duration and return ErrTimeout. If timeout
+// is zero, immediately return ErrEmpty. Once the queue is closed, the remaining
+// items are still returned, after which ErrClosed is returned.
+func (bq *BlockingPriorityQueue[T]) Pop(timeout ...time.Duration) (T, error) {
+	return bq.pop(context.Background(), timeout...)
+}
+
+// PopContext will return the item with the highest priority. If the queue is
+// empty, block until an item is pushed to the queue or ctx is done, in which
+// case ctx.Err() is returned. Once the queue is closed, the remaining items
+// are still returned, after which ErrClosed is returned.
+func (bq *BlockingPriorityQueue[T]) PopContext(ctx context.Context) (T, error) {
+	return bq.pop(ctx)
+}
+
+func (bq *BlockingPriorityQueue[T]) pop(ctx context.Context, timeout ...time.Duration) (T, error) {
+	var zero T
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	bq.mutex.Lock()
+	for {
+		if !bq.pq.Empty() {
+			item, _ := bq.pq.Pop()
+			broadcast(&bq.notFull)
+			bq.mutex.Unlock()
+			return item, nil
+		}
+		if bq.IsClosed() {
+			bq.mutex.Unlock()
+			return zero, ErrClosed
+		}
+		if len(timeout) > 0 && timeout[0] <= 0 {
+			bq.mutex.Unlock()
+			return zero, ErrEmpty
+		}
+		if len(timeout) > 0 && timer == nil {
+			timer = time.NewTimer(timeout[0])
+		}
+
+		notEmpty := waitFor(&bq.notEmpty)
+		bq.mutex.Unlock()
+		if err := bq.wait(ctx, notEmpty, timer); err != nil {
+			return zero, err
+		}
+		bq.mutex.Lock()
+	}
+}
+
+// wait blocks until ready is closed, the queue is closed, ctx is done
+// or the timer, if any, fires. A nil error means the operation should retry.
+func (bq *BlockingPriorityQueue[T]) wait(ctx context.Context, ready <-chan struct{}, timer *time.Timer) error {
+	var timeout <-chan time.Time
+	if timer != nil {
+		timeout = timer.C
+	}
+	select {
+	case <-ready:
+	case <-bq.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return ErrTimeout
+	}
+	return nil
+}
+
+// Close closes the queue and wakes up all blocked producers and consumers.
+// Further pushes return ErrClosed, while pops keep returning the remaining
+// items until the queue is drained. Close is idempotent.
+func (bq *BlockingPriorityQueue[T]) Close() {
+	bq.closer.Do(func() {
+		close(bq.done)
+	})
+}
+
+// IsClosed reports whether the queue has been closed.
+func (bq *BlockingPriorityQueue[T]) IsClosed() bool {
+	return isDone(bq.done)
+}
+
+// Len returns the number of items in the queue.
+func (bq *BlockingPriorityQueue[T]) Len() int {
+	bq.mutex.Lock()
+	defer bq.mutex.Unlock()
+	return bq.pq.Len()
+}
+
+// Empty returns whether the queue is empty.
+func (bq *BlockingPriorityQueue[T]) Empty() bool {
+	return bq.Len() == 0
+}
+
+// waitFor returns the channel to wait on for a condition, creating it if
+// nobody waits for the condition yet. It must be called with the lock held.
+func waitFor(cond *chan struct{}) <-chan struct{} {
+	if *cond == nil {
+		*cond = make(chan struct{})
+	}
+	return *cond
+}
+
+// broadcast wakes up everyone waiting for a condition. It must be called
+// with the lock held.
+func broadcast(cond *chan struct{}) {
+	if *cond != nil {
+		close(*cond)
+		*cond = nil
+	}
+}
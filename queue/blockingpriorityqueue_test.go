@@ -0,0 +1,191 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockingPriorityQueuePushPop(t *testing.T) {
+	bq := NewBlockingPriorityQueue(func(a, b int) bool {
+		return a > b
+	})
+
+	assert.True(t, bq.Empty())
+	assert.Zero(t, bq.Len())
+
+	bq.Push(2)
+	bq.Push(3)
+	bq.Push(1)
+	assert.Equal(t, 3, bq.Len())
+
+	for _, expected := range []int{3, 2, 1} {
+		val, err := bq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, expected, val)
+	}
+
+	val, err := bq.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+	assert.Zero(t, val)
+	val, err = bq.Pop(time.Millisecond)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Zero(t, val)
+
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		err := bq.Push(4)
+		assert.Nil(t, err)
+	}()
+	val, err = bq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, val)
+}
+
+func TestBlockingPriorityQueueCapacity(t *testing.T) {
+	bq := NewBlockingPriorityQueue(func(a, b int) bool {
+		return a > b
+	}, 2)
+
+	assert.Nil(t, bq.Push(1))
+	assert.Nil(t, bq.Push(2))
+	assert.Equal(t, ErrFull, bq.Push(3, 0))
+	assert.Equal(t, ErrTimeout, bq.Push(3, time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, bq.PushContext(ctx, 3))
+
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		val, err := bq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, 2, val)
+	}()
+	assert.Nil(t, bq.Push(3))
+
+	val, err := bq.PopContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+	val, err = bq.PopContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		cancel()
+	}()
+	val, err = bq.PopContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+	assert.Zero(t, val)
+}
+
+func TestBlockingPriorityQueueClose(t *testing.T) {
+	bq := NewBlockingPriorityQueue(func(a, b int) bool {
+		return a > b
+	}, 1)
+	assert.False(t, bq.IsClosed())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		val, err := bq.Pop()
+		assert.Equal(t, ErrClosed, err)
+		assert.Zero(t, val)
+	}()
+	time.Sleep(2 * time.Millisecond)
+	bq.Close()
+	wg.Wait()
+	assert.True(t, bq.IsClosed())
+
+	bq = NewBlockingPriorityQueue(func(a, b int) bool {
+		return a > b
+	}, 1)
+	bq.Push(1)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := bq.Push(2)
+		assert.Equal(t, ErrClosed, err)
+	}()
+	time.Sleep(2 * time.Millisecond)
+	bq.Close()
+	bq.Close()
+	wg.Wait()
+
+	assert.Equal(t, ErrClosed, bq.Push(2, 0))
+	val, err := bq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	val, err = bq.Pop(0)
+	assert.Equal(t, ErrClosed, err)
+	assert.Zero(t, val)
+}
+
+func TestBlockingPriorityQueueConcurrent(t *testing.T) {
+	const producers, items = 4, 1000
+	bq := NewBlockingPriorityQueue(func(a, b int) bool {
+		return a > b
+	}, 16)
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < items; i++ {
+				assert.Nil(t, bq.Push(p*items+i))
+			}
+		}(p)
+	}
+
+	seen := make([]bool, producers*items)
+	var mu sync.Mutex
+	var cwg sync.WaitGroup
+	for c := 0; c < producers; c++ {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			for {
+				val, err := bq.Pop()
+				if err == ErrClosed {
+					return
+				}
+				assert.Nil(t, err)
+				mu.Lock()
+				assert.False(t, seen[val])
+				seen[val] = true
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	bq.Close()
+	cwg.Wait()
+	for _, ok := range seen {
+		assert.True(t, ok)
+	}
+}
+
+func BenchmarkBlockingPriorityQueueParallelPushPop(b *testing.B) {
+	bq := NewBlockingPriorityQueue(func(a, b int) bool {
+		return a > b
+	})
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			bq.Push(i)
+			bq.Pop()
+			i++
+		}
+	})
+}
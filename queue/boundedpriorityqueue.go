@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"time"
+)
+
+// BoundedPriorityQueue is a priority queue of a fixed capacity that keeps
+// the items of the highest priority, e.g. the top K results of a search.
+// Once it is full, pushing an item evicts the item of the lowest priority
+// if the pushed one has a higher priority, or is rejected otherwise.
+// Both ends are popped in O(log n). It is not safe for concurrent use.
+type BoundedPriorityQueue[T any] struct {
+	heap     *MinMaxHeap[T]
+	capacity int
+}
+
+// NewBoundedPriorityQueue will allocate a BoundedPriorityQueue of the capacity.
+// Function comparePriority reports whether the element a has higher priority than the element b.
+func NewBoundedPriorityQueue[T any](comparePriority func(a, b T) bool, capacity int) *BoundedPriorityQueue[T] {
+	if capacity <= 0 {
+		panic("BoundedPriorityQueue capacity must be greater than 0")
+	}
+	return &BoundedPriorityQueue[T]{
+		heap:     NewMinMaxHeap(comparePriority, capacity),
+		capacity: capacity,
+	}
+}
+
+// Push adds the item to the queue. If the queue is full, evict the item
+// with the lowest priority if the item has a higher priority, or otherwise
+// return ErrFull. It never blocks.
+func (bq *BoundedPriorityQueue[T]) Push(item T, timeout ...time.Duration) error {
+	if _, ok := bq.PushEvict(item); !ok {
+		return ErrFull
+	}
+	return nil
+}
+
+// PushEvict is like Push, but returns the evicted item, if any, and reports
+// false if the item was rejected.
+func (bq *BoundedPriorityQueue[T]) PushEvict(item T) (evicted T, ok bool) {
+	if bq.heap.Len() < bq.capacity {
+		bq.heap.push(item)
+		return evicted, true
+	}
+	i := bq.heap.minIndex()
+	if !bq.heap.higher(item, bq.heap.items[i]) {
+		return evicted, false
+	}
+	evicted = bq.heap.removeAt(i)
+	bq.heap.push(item)
+	return evicted, true
+}
+
+// Pop is PopMax, so that the queue pops in priority order like PriorityQueue.
+func (bq *BoundedPriorityQueue[T]) Pop(timeout ...time.Duration) (T, error) {
+	return bq.PopMax()
+}
+
+// PopMax removes and returns the item with the highest priority,
+// or returns ErrEmpty if the queue is empty.
+func (bq *BoundedPriorityQueue[T]) PopMax() (T, error) {
+	return bq.heap.PopMax()
+}
+
+// PopMin removes and returns the item with the lowest priority,
+// or returns ErrEmpty if the queue is empty.
+func (bq *BoundedPriorityQueue[T]) PopMin() (T, error) {
+	return bq.heap.PopMin()
+}
+
+// PeekMin returns the item with the lowest priority without removing it,
+// or returns ErrEmpty if the queue is empty. Once the queue is full, it is
+// the item that a pushed item has to outrank.
+func (bq *BoundedPriorityQueue[T]) PeekMin() (T, error) {
+	return bq.heap.PeekMin()
+}
+
+// Drain removes and returns all items, from the highest priority to the lowest.
+func (bq *BoundedPriorityQueue[T]) Drain() []T {
+	items := make([]T, 0, bq.heap.Len())
+	for !bq.heap.Empty() {
+		item, _ := bq.heap.PopMax()
+		items = append(items, item)
+	}
+	return items
+}
+
+// Len returns the number of items in the queue.
+func (bq *BoundedPriorityQueue[T]) Len() int {
+	return bq.heap.Len()
+}
+
+// Empty returns whether the queue is empty.
+func (bq *BoundedPriorityQueue[T]) Empty() bool {
+	return bq.heap.Empty()
+}
@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoundedPriorityQueue(t *testing.T) {
+	bq := NewBoundedPriorityQueue(func(a, b int) bool { return a > b }, 3)
+
+	for _, i := range []int{5, 1, 3} {
+		assert.Nil(t, bq.Push(i))
+	}
+	assert.Equal(t, 3, bq.Len())
+	val, err := bq.PeekMin()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+
+	// a lower item is rejected, a higher one evicts the lowest
+	assert.Equal(t, ErrFull, bq.Push(0))
+	evicted, ok := bq.PushEvict(4)
+	assert.True(t, ok)
+	assert.Equal(t, 1, evicted)
+	_, ok = bq.PushEvict(3)
+	assert.False(t, ok)
+	assert.Equal(t, 3, bq.Len())
+
+	val, err = bq.PopMax()
+	assert.Nil(t, err)
+	assert.Equal(t, 5, val)
+	val, err = bq.PopMin()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+	val, err = bq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, val)
+
+	_, err = bq.PopMax()
+	assert.Equal(t, ErrEmpty, err)
+	_, err = bq.PopMin()
+	assert.Equal(t, ErrEmpty, err)
+	_, err = bq.PeekMin()
+	assert.Equal(t, ErrEmpty, err)
+	assert.True(t, bq.Empty())
+}
+
+func TestBoundedPriorityQueueTopK(t *testing.T) {
+	const k = 10
+	bq := NewBoundedPriorityQueue(func(a, b int) bool { return a > b }, k)
+
+	r := rand.New(rand.NewSource(1))
+	all := make([]int, 1000)
+	for i := range all {
+		all[i] = r.Intn(500)
+		bq.Push(all[i])
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(all)))
+	assert.Equal(t, all[:k], bq.Drain())
+	assert.True(t, bq.Empty())
+}
+
+func TestBoundedPriorityQueueBothEnds(t *testing.T) {
+	const n = 200
+	bq := NewBoundedPriorityQueue(func(a, b int) bool { return a < b }, n)
+
+	r := rand.New(rand.NewSource(2))
+	var sorted []int
+	for i := 0; i < n; i++ {
+		val := r.Intn(100)
+		bq.Push(val)
+		sorted = append(sorted, val)
+	}
+	sort.Ints(sorted)
+
+	// alternate the ends, which must meet in the middle
+	for len(sorted) > 0 {
+		val, err := bq.PopMax()
+		assert.Nil(t, err)
+		assert.Equal(t, sorted[0], val)
+		sorted = sorted[1:]
+		if len(sorted) == 0 {
+			break
+		}
+		val, err = bq.PopMin()
+		assert.Nil(t, err)
+		assert.Equal(t, sorted[len(sorted)-1], val)
+		sorted = sorted[:len(sorted)-1]
+	}
+	assert.True(t, bq.Empty())
+}
@@ -1,66 +1,331 @@
-package queue
-
-import (
-	"time"
-	"errors"
-)
-
-var (
-	ErrTimeout = errors.New("queue timeout")
-	ErrFull = errors.New("queue full")
-	ErrEmpty = errors.New("queue empty")
-)
-
-type ChannelQueue chan interface{}
-
-func NewChannelQueue(capacity int) ChannelQueue {
-	return make(chan interface{}, capacity)
-}
-
-func (cq ChannelQueue) Push(item interface{}, timeout ...time.Duration) error {
-	if len(timeout) == 0 {
-		select {
-		case cq <- item:
-			return nil
-		}
-	}
-
-	select {
-	case cq <- item:
-		return nil
-	case <-time.After(timeout[0]):
-		if timeout[0] <= 0 {
-			return ErrFull
-		} else {
-			return ErrTimeout
-		}
-	}
-}
-
-func (cq ChannelQueue) Pop(timeout ...time.Duration) (interface{}, error) {
-	if len(timeout) == 0 {
-		select {
-		case item := <-cq:
-			return item, nil
-		}
-	}
-
-	select {
-	case item := <-cq:
-		return item, nil
-	case <-time.After(timeout[0]):
-		if timeout[0] <= 0 {
-			return nil, ErrEmpty
-		} else {
-			return nil, ErrTimeout
-		}
-	}
-}
-
-func (cq ChannelQueue) Len() int {
-	return len(cq)
-}
-
-func (cq ChannelQueue) Empty() bool {
-	return len(cq) == 0
-}
+package queue
+
+import (
+	"context"
+	"time"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ridewindx/crumb/functional"
+)
+
+var (
+	ErrTimeout = errors.New("queue timeout")
+	ErrFull = errors.New("queue full")
+	ErrEmpty = errors.New("queue empty")
+	ErrClosed = errors.New("queue closed")
+)
+
+// ChannelQueue is a bounded queue backed by a buffered channel.
+type ChannelQueue[T any] struct {
+	items    chan chanentry[T]
+	slots    chan struct{} // one per item, whether in the channel or held
+	done     chan struct{}
+	closer   sync.Once
+	pushed   atomic.Uint64       // the sequence of the last pushed item
+	mutex    sync.Mutex          // guards held and refilled
+	held     Deque[chanentry[T]] // items taken out of the channel by Peek or Snapshot
+	holding  atomic.Int64        // held.Len(), plus one while hold is running
+	refilled chan struct{}       // closed when items get held
+}
+
+// chanentry is an item in the channel of a ChannelQueue, along with its
+// sequence, which tells whether a popped item was pushed before the held ones.
+type chanentry[T any] struct {
+	item T
+	seq  uint64
+}
+
+func NewChannelQueue[T any](capacity int) *ChannelQueue[T] {
+	return &ChannelQueue[T]{
+		items: make(chan chanentry[T], capacity),
+		slots: make(chan struct{}, capacity),
+		done:  make(chan struct{}),
+	}
+}
+
+// Push adds the item to the queue. If the queue is full, will block
+// until an item is popped from the queue. If a nonzero timeout is specified,
+// block no more than the timeout duration and return ErrTimeout. If timeout
+// is zero, immediately return ErrFull. If the queue is closed, return ErrClosed.
+func (cq *ChannelQueue[T]) Push(item T, timeout ...time.Duration) error {
+	if cq.IsClosed() {
+		return ErrClosed
+	}
+
+	if len(timeout) == 0 {
+		select {
+		case cq.slots <- struct{}{}:
+		case <-cq.done:
+			return ErrClosed
+		}
+	} else if timeout[0] <= 0 {
+		select {
+		case cq.slots <- struct{}{}:
+		default:
+			return ErrFull
+		}
+	} else {
+		select {
+		case cq.slots <- struct{}{}:
+		case <-cq.done:
+			return ErrClosed
+		case <-time.After(timeout[0]):
+			return ErrTimeout
+		}
+	}
+	cq.send(item)
+	return nil
+}
+
+// PushContext adds the item to the queue. If the queue is full, will block
+// until an item is popped from the queue or ctx is done, in which case
+// ctx.Err() is returned. If the queue is closed, return ErrClosed.
+func (cq *ChannelQueue[T]) PushContext(ctx context.Context, item T) error {
+	if cq.IsClosed() {
+		return ErrClosed
+	}
+
+	select {
+	case cq.slots <- struct{}{}:
+	default:
+		select {
+		case cq.slots <- struct{}{}:
+		case <-cq.done:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	cq.send(item)
+	return nil
+}
+
+// send adds the item to the channel, which has room for it as the push
+// took a slot. Items held by Peek or Snapshot keep their slots, so that they
+// still count toward the capacity.
+func (cq *ChannelQueue[T]) send(item T) {
+	cq.items <- chanentry[T]{item: item, seq: cq.pushed.Add(1)}
+}
+
+// Pop will return the next item in the queue. If the queue is empty,
+// block until an item is pushed to the queue. If a nonzero timeout is specified,
+// block no more than the timeout duration and return ErrTimeout. If timeout
+// is zero, immediately return ErrEmpty. Once the queue is closed, the remaining
+// items are still returned, after which ErrClosed is returned.
+func (cq *ChannelQueue[T]) Pop(timeout ...time.Duration) (T, error) {
+	return cq.pop(context.Background(), timeout...)
+}
+
+// PopContext will return the next item in the queue. If the queue is empty,
+// block until an item is pushed to the queue or ctx is done, in which case
+// ctx.Err() is returned. Once the queue is closed, the remaining items are
+// still returned, after which ErrClosed is returned.
+func (cq *ChannelQueue[T]) PopContext(ctx context.Context) (T, error) {
+	return cq.pop(ctx)
+}
+
+func (cq *ChannelQueue[T]) pop(ctx context.Context, timeout ...time.Duration) (T, error) {
+	item, err := cq.take(ctx, timeout...)
+	if err == nil {
+		<-cq.slots // free the slot of the item
+	}
+	return item, err
+}
+
+// take removes the next item, from the held ones or the channel.
+func (cq *ChannelQueue[T]) take(ctx context.Context, timeout ...time.Duration) (T, error) {
+	var zero T
+	var expired <-chan time.Time
+	if len(timeout) > 0 && timeout[0] > 0 {
+		timer := time.NewTimer(timeout[0])
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		if cq.holding.Load() == 0 {
+			select {
+			case entry := <-cq.items:
+				return cq.reorder(entry), nil
+			default:
+			}
+		}
+		item, ok, refilled := cq.popHeld()
+		if ok {
+			return item, nil
+		}
+
+		if len(timeout) > 0 && timeout[0] <= 0 {
+			select {
+			case entry := <-cq.items:
+				return cq.reorder(entry), nil
+			case <-cq.done:
+				return cq.drain()
+			default:
+				return zero, ErrEmpty
+			}
+		}
+
+		select {
+		case entry := <-cq.items:
+			return cq.reorder(entry), nil
+		case <-refilled:
+			// Peek or Snapshot took items out of the channel
+		case <-cq.done:
+			return cq.drain()
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-expired:
+			return zero, ErrTimeout
+		}
+	}
+}
+
+// popHeld removes and returns the front held item if there is one.
+// Otherwise it returns a channel closed when items get held.
+func (cq *ChannelQueue[T]) popHeld() (T, bool, <-chan struct{}) {
+	cq.mutex.Lock()
+	defer cq.mutex.Unlock()
+
+	if entry, err := cq.held.PopFront(); err == nil {
+		cq.holding.Store(int64(cq.held.Len()))
+		return entry.item, true, nil
+	}
+	var zero T
+	return zero, false, waitFor(&cq.refilled)
+}
+
+// reorder returns the item of the entry received from the channel, unless
+// items pushed before it are held, in which case it returns the front held
+// item and holds the received one in the order it was pushed.
+func (cq *ChannelQueue[T]) reorder(entry chanentry[T]) T {
+	if cq.holding.Load() == 0 {
+		return entry.item
+	}
+	cq.mutex.Lock()
+	defer cq.mutex.Unlock()
+
+	// a pop blocked on the channel may have received its item before
+	// hold took the later ones
+	if front, err := cq.held.PeekFront(); err == nil && front.seq < entry.seq {
+		cq.insertHeld(entry)
+		entry, _ = cq.held.PopFront()
+	}
+	return entry.item
+}
+
+// insertHeld holds the entry among the held ones by its sequence, as
+// Snapshot may have held items pushed after it. It must be called with the
+// lock held.
+func (cq *ChannelQueue[T]) insertHeld(entry chanentry[T]) {
+	var later []chanentry[T]
+	for {
+		back, err := cq.held.PeekBack()
+		if err != nil || back.seq < entry.seq {
+			break
+		}
+		cq.held.PopBack()
+		later = append(later, back)
+	}
+	cq.held.PushBack(entry)
+	for i := len(later) - 1; i >= 0; i-- {
+		cq.held.PushBack(later[i])
+	}
+}
+
+// drain returns the next remaining item of a closed queue,
+// or ErrClosed if there is none.
+func (cq *ChannelQueue[T]) drain() (T, error) {
+	if item, ok, _ := cq.popHeld(); ok {
+		return item, nil
+	}
+	select {
+	case entry := <-cq.items:
+		return cq.reorder(entry), nil
+	default:
+		var zero T
+		return zero, ErrClosed
+	}
+}
+
+// Peek returns the next item in the queue without removing it, or returns
+// ErrEmpty if the queue is empty. As a channel cannot be peeked, the item
+// is taken out of it and held until popped, and meanwhile still counts
+// toward the capacity.
+func (cq *ChannelQueue[T]) Peek() (T, error) {
+	cq.mutex.Lock()
+	defer cq.mutex.Unlock()
+
+	if cq.held.Empty() {
+		cq.hold(1)
+	}
+	entry, err := cq.held.PeekFront()
+	return entry.item, err
+}
+
+// Snapshot returns a copy of the items in the queue, in order. Like Peek,
+// it takes the items out of the channel and holds them until popped.
+func (cq *ChannelQueue[T]) Snapshot() []T {
+	cq.mutex.Lock()
+	defer cq.mutex.Unlock()
+
+	cq.hold(cap(cq.items))
+	items := make([]T, cq.held.Len())
+	for i := range items {
+		items[i] = cq.held.At(i).item
+	}
+	return items
+}
+
+// Iterator returns an iterator over a Snapshot of the queue.
+func (cq *ChannelQueue[T]) Iterator() functional.Iterator {
+	return newSnapshotIterator(cq.Snapshot())
+}
+
+// hold takes up to n items out of the channel into the held items.
+// It must be called with the lock held.
+func (cq *ChannelQueue[T]) hold(n int) {
+	// pops receiving from the channel meanwhile must reorder their item
+	cq.holding.Store(int64(cq.held.Len()) + 1)
+	defer func() {
+		cq.holding.Store(int64(cq.held.Len()))
+	}()
+
+loop:
+	for i := 0; i < n; i++ {
+		select {
+		case entry := <-cq.items:
+			cq.held.PushBack(entry)
+		default:
+			break loop
+		}
+	}
+	if !cq.held.Empty() {
+		broadcast(&cq.refilled) // wake up pops blocked on the channel
+	}
+}
+
+// Close closes the queue and wakes up all blocked producers and consumers.
+// Further pushes return ErrClosed, while pops keep returning the remaining
+// items until the queue is drained. Close is idempotent.
+func (cq *ChannelQueue[T]) Close() {
+	cq.closer.Do(func() {
+		close(cq.done)
+	})
+}
+
+// IsClosed reports whether the queue has been closed.
+func (cq *ChannelQueue[T]) IsClosed() bool {
+	return isDone(cq.done)
+}
+
+// Len returns the number of items in the queue, including the held ones.
+func (cq *ChannelQueue[T]) Len() int {
+	return len(cq.slots)
+}
+
+func (cq *ChannelQueue[T]) Empty() bool {
+	return cq.Len() == 0
+}
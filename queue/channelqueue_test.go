@@ -1,147 +1,403 @@
-package queue
-
-import (
-	"testing"
-	"github.com/stretchr/testify/assert"
-	"sync"
-)
-
-func TestChannelQueuePush(t *testing.T) {
-	q := NewChannelQueue(10)
-
-	q.Push(`test`)
-	assert.Equal(t, 1, q.Len())
-
-	result, err := q.Pop()
-	assert.Nil(t, err)
-	assert.Equal(t, `test`, result)
-	assert.True(t, q.Empty())
-
-	q.Push(`test2`)
-	assert.Equal(t, 1, q.Len())
-
-	result, err = q.Pop()
-	assert.Nil(t, err)
-
-	assert.Equal(t, `test2`, result)
-	assert.True(t, q.Empty())
-}
-
-func TestChannelQueuePop(t *testing.T) {
-	q := NewChannelQueue(10)
-
-	q.Push(`test`)
-	result, err := q.Pop()
-	assert.Nil(t, err)
-
-	assert.Equal(t, `test`, result)
-	assert.Equal(t, 0, q.Len())
-
-	q.Push(`1`)
-	q.Push(`2`)
-
-	result, err = q.Pop()
-	assert.Nil(t, err)
-
-	assert.Equal(t, `1`, result)
-	assert.Equal(t, 1, q.Len())
-
-	result, err = q.Pop()
-	assert.Nil(t, err)
-
-	assert.Equal(t, `2`, result)
-}
-
-func BenchmarkChannelQueuePushPop(b *testing.B) {
-	rq := NewChannelQueue(64)
-
-	var count int
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
-		for {
-			_, err := rq.Pop()
-			assert.Nil(b, err)
-
-			count++
-			if count == b.N {
-				return
-			}
-		}
-	}()
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		rq.Push(i)
-	}
-
-	wg.Wait()
-}
-
-func BenchmarkChannelQueuePush(b *testing.B) {
-	rq := NewChannelQueue(b.N)
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		rq.Push(i)
-	}
-}
-
-func BenchmarkChannelQueuePop(b *testing.B) {
-	rq := NewChannelQueue(b.N)
-
-	for i := 0; i < b.N; i++ {
-		err := rq.Push(i)
-		assert.Nil(b, err)
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		rq.Pop()
-	}
-}
-
-func BenchmarkChannelQueueParallelPushPop(b *testing.B) {
-	rq := NewChannelQueue(b.N)
-
-	b.ResetTimer()
-	b.RunParallel(func(pb *testing.PB) {
-		i := 0
-		for pb.Next() {
-			rq.Push(i)
-			rq.Pop()
-			i++
-		}
-	})
-}
-
-func BenchmarkChannelQueueParallelPush(b *testing.B) {
-	rq := NewChannelQueue(b.N)
-
-	b.ResetTimer()
-	b.RunParallel(func(pb *testing.PB) {
-		i := 0
-		for pb.Next() {
-			rq.Push(i)
-			i++
-		}
-	})
-}
-
-func BenchmarkChannelQueueParallelPop(b *testing.B) {
-	rq := NewChannelQueue(b.N)
-
-	for i := 0; i < b.N; i++ {
-		err := rq.Push(i)
-		assert.Nil(b, err)
-	}
-
-	b.ResetTimer()
-	b.RunParallel(func(pb *testing.PB) {
-		for pb.Next() {
-			rq.Pop()
-		}
-	})
-}
+package queue
+
+import (
+	"context"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"time"
+)
+
+func TestChannelQueuePush(t *testing.T) {
+	q := NewChannelQueue[string](10)
+
+	q.Push(`test`)
+	assert.Equal(t, 1, q.Len())
+
+	result, err := q.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, `test`, result)
+	assert.True(t, q.Empty())
+
+	q.Push(`test2`)
+	assert.Equal(t, 1, q.Len())
+
+	result, err = q.Pop()
+	assert.Nil(t, err)
+
+	assert.Equal(t, `test2`, result)
+	assert.True(t, q.Empty())
+}
+
+func TestChannelQueuePop(t *testing.T) {
+	q := NewChannelQueue[string](10)
+
+	q.Push(`test`)
+	result, err := q.Pop()
+	assert.Nil(t, err)
+
+	assert.Equal(t, `test`, result)
+	assert.Equal(t, 0, q.Len())
+
+	q.Push(`1`)
+	q.Push(`2`)
+
+	result, err = q.Pop()
+	assert.Nil(t, err)
+
+	assert.Equal(t, `1`, result)
+	assert.Equal(t, 1, q.Len())
+
+	result, err = q.Pop()
+	assert.Nil(t, err)
+
+	assert.Equal(t, `2`, result)
+}
+
+func TestChannelQueueContext(t *testing.T) {
+	q := NewChannelQueue[string](1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(2*time.Millisecond)
+		cancel()
+	}()
+	result, err := q.PopContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+	assert.Zero(t, result)
+
+	err = q.PushContext(context.Background(), `1`)
+	assert.Nil(t, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Millisecond)
+	defer cancel()
+	err = q.PushContext(ctx, `2`)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, q.Len())
+
+	result, err = q.PopContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, `1`, result)
+}
+
+func TestChannelQueueClose(t *testing.T) {
+	q := NewChannelQueue[string](1)
+	assert.False(t, q.IsClosed())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		result, err := q.Pop()
+		assert.Equal(t, ErrClosed, err)
+		assert.Zero(t, result)
+	}()
+	time.Sleep(2*time.Millisecond)
+	q.Close()
+	wg.Wait()
+	assert.True(t, q.IsClosed())
+
+	q = NewChannelQueue[string](1)
+	q.Push(`1`)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := q.Push(`2`)
+		assert.Equal(t, ErrClosed, err)
+	}()
+	time.Sleep(2*time.Millisecond)
+	q.Close()
+	q.Close()
+	wg.Wait()
+
+	err := q.Push(`2`, 0)
+	assert.Equal(t, ErrClosed, err)
+	err = q.PushContext(context.Background(), `2`)
+	assert.Equal(t, ErrClosed, err)
+
+	result, err := q.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, `1`, result)
+	result, err = q.Pop(0)
+	assert.Equal(t, ErrClosed, err)
+	assert.Zero(t, result)
+	result, err = q.PopContext(context.Background())
+	assert.Equal(t, ErrClosed, err)
+	assert.Zero(t, result)
+}
+
+func TestChannelQueuePopZeroTimeout(t *testing.T) {
+	q := NewChannelQueue[int](1)
+
+	_, err := q.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+
+	// a zero timeout never wins over an item that is already there
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+		result, err := q.Pop(0)
+		assert.Nil(t, err)
+		assert.Equal(t, i, result)
+	}
+}
+
+func TestChannelQueuePushZeroTimeout(t *testing.T) {
+	q := NewChannelQueue[int](1)
+
+	// a zero timeout never wins over a free slot
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, q.Push(i, 0))
+		assert.Equal(t, ErrFull, q.Push(i, 0))
+		q.Pop()
+	}
+}
+
+func TestChannelQueuePeekSnapshot(t *testing.T) {
+	q := NewChannelQueue[int](4)
+
+	_, err := q.Peek()
+	assert.Equal(t, ErrEmpty, err)
+	assert.Empty(t, q.Snapshot())
+
+	q.Push(1)
+	q.Push(2)
+	val, err := q.Peek()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	assert.Equal(t, 2, q.Len())
+
+	// items held by Peek and Snapshot are still popped in order
+	q.Push(3)
+	assert.Equal(t, []int{1, 2, 3}, q.Snapshot())
+	assert.Equal(t, 3, q.Len())
+	q.Push(4)
+	assertIterator(t, q.Iterator(), 1, 2, 3, 4)
+	for i := 1; i <= 4; i++ {
+		val, err = q.Pop(0)
+		assert.Nil(t, err)
+		assert.Equal(t, i, val)
+	}
+	assert.True(t, q.Empty())
+
+	// a blocked pop is woken up when its item gets held
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		q.Push(5)
+		q.Peek()
+	}()
+	val, err = q.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 5, val)
+
+	q.Push(6)
+	q.Peek()
+	q.Close()
+	val, err = q.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 6, val)
+	_, err = q.Pop()
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestChannelQueueSnapshotConcurrent(t *testing.T) {
+	const n = 2000
+	q := NewChannelQueue[int](16)
+
+	go func() {
+		for i := 0; i < n; i++ {
+			q.Push(i)
+		}
+	}()
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				q.Snapshot()
+				q.Peek()
+			}
+		}
+	}()
+
+	// a single consumer still sees the items in order
+	for i := 0; i < n; i++ {
+		val, err := q.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, i, val)
+	}
+	close(stop)
+}
+
+func TestChannelQueuePeekSnapshotOrder(t *testing.T) {
+	const n = 2000
+	q := NewChannelQueue[int](8)
+
+	go func() {
+		for i := 0; i < n; i++ {
+			q.Push(i)
+		}
+	}()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, inspect := range []func(){
+		func() { q.Peek() },
+		func() { q.Snapshot() },
+		func() { q.Snapshot() },
+	} {
+		wg.Add(1)
+		go func(inspect func()) {
+			defer wg.Done()
+			for !isDone(stop) {
+				inspect()
+			}
+		}(inspect)
+	}
+
+	// pops race with Peek and Snapshot taking items out of the channel,
+	// and still see the items in order
+	for i := 0; i < n; i++ {
+		val, err := q.Pop()
+		assert.Nil(t, err)
+		if val != i {
+			assert.Equal(t, i, val)
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestChannelQueueReorder(t *testing.T) {
+	q := NewChannelQueue[int](8)
+
+	// a pop received 5 from the channel after Peek held 4, and before
+	// Snapshot held 6 and 7
+	for _, seq := range []uint64{4, 6, 7} {
+		q.held.PushBack(chanentry[int]{item: int(seq), seq: seq})
+	}
+	q.holding.Store(3)
+	assert.Equal(t, 4, q.reorder(chanentry[int]{item: 5, seq: 5}))
+	assert.Equal(t, []int{5, 6, 7}, q.Snapshot())
+}
+
+func TestChannelQueuePeekCapacity(t *testing.T) {
+	q := NewChannelQueue[int](2)
+	q.Push(1)
+	q.Push(2)
+
+	// held items still count toward the capacity
+	q.Peek()
+	assert.Equal(t, ErrFull, q.Push(3, 0))
+	q.Snapshot()
+	assert.Equal(t, ErrFull, q.Push(3, 0))
+	assert.Equal(t, ErrTimeout, q.Push(3, time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, q.PushContext(ctx, 3))
+	assert.Equal(t, 2, q.Len())
+
+	// a blocked push gets the slot of a popped held item
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		q.Pop()
+	}()
+	assert.Nil(t, q.Push(3))
+	assert.Equal(t, []int{2, 3}, q.Snapshot())
+}
+
+func BenchmarkChannelQueuePushPop(b *testing.B) {
+	rq := NewChannelQueue[int](64)
+
+	var count int
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		for {
+			_, err := rq.Pop()
+			assert.Nil(b, err)
+
+			count++
+			if count == b.N {
+				return
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rq.Push(i)
+	}
+
+	wg.Wait()
+}
+
+func BenchmarkChannelQueuePush(b *testing.B) {
+	rq := NewChannelQueue[int](b.N)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rq.Push(i)
+	}
+}
+
+func BenchmarkChannelQueuePop(b *testing.B) {
+	rq := NewChannelQueue[int](b.N)
+
+	for i := 0; i < b.N; i++ {
+		err := rq.Push(i)
+		assert.Nil(b, err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rq.Pop()
+	}
+}
+
+func BenchmarkChannelQueueParallelPushPop(b *testing.B) {
+	rq := NewChannelQueue[int](b.N)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			rq.Push(i)
+			rq.Pop()
+			i++
+		}
+	})
+}
+
+func BenchmarkChannelQueueParallelPush(b *testing.B) {
+	rq := NewChannelQueue[int](b.N)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			rq.Push(i)
+			i++
+		}
+	})
+}
+
+func BenchmarkChannelQueueParallelPop(b *testing.B) {
+	rq := NewChannelQueue[int](b.N)
+
+	for i := 0; i < b.N; i++ {
+		err := rq.Push(i)
+		assert.Nil(b, err)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rq.Pop()
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"time"
+)
+
+// DedupPolicy determines what pushing an item already pending in a
+// DedupQueue does.
+type DedupPolicy int
+
+const (
+	// DedupKeep ignores the push, so the pending item keeps its place.
+	DedupKeep DedupPolicy = iota
+	// DedupMoveToBack replaces the pending item with the pushed one,
+	// at the back of the queue.
+	DedupMoveToBack
+)
+
+// DedupQueue is an unbounded FIFO queue that holds each item at most once,
+// like a Queue combined with a set of the pending items. Items are told
+// apart by a key, which is the item itself for NewDedupQueue.
+// It is not safe for concurrent use.
+type DedupQueue[T any, K comparable] struct {
+	deque   Deque[dedupentry[T, K]]
+	pending map[K]uint64 // seq of the entry of each pending item
+	key     func(item T) K
+	policy  DedupPolicy
+	seq     uint64
+}
+
+// dedupentry is an item in the deque, which is stale if its seq is not
+// the pending one of its key, because the item was moved to the back.
+type dedupentry[T any, K comparable] struct {
+	item T
+	key  K
+	seq  uint64
+}
+
+// NewDedupQueue will allocate a DedupQueue of comparable items.
+func NewDedupQueue[T comparable](policy DedupPolicy) *DedupQueue[T, T] {
+	return NewDedupQueueFunc(policy, func(item T) T { return item })
+}
+
+// NewDedupQueueFunc will allocate a DedupQueue whose items are told apart
+// by the key function, e.g. for items that are not comparable.
+func NewDedupQueueFunc[T any, K comparable](policy DedupPolicy, key func(item T) K) *DedupQueue[T, K] {
+	return &DedupQueue[T, K]{
+		pending: make(map[K]uint64),
+		key:     key,
+		policy:  policy,
+	}
+}
+
+// Push adds the item to the back of the queue, unless it is already
+// pending, in which case the policy applies. It never fails.
+func (dq *DedupQueue[T, K]) Push(item T, timeout ...time.Duration) error {
+	key := dq.key(item)
+	if _, ok := dq.pending[key]; ok && dq.policy == DedupKeep {
+		return nil
+	}
+	dq.seq++
+	dq.pending[key] = dq.seq
+	dq.deque.PushBack(dedupentry[T, K]{item: item, key: key, seq: dq.seq})
+	dq.compact()
+	return nil
+}
+
+// Pop removes and returns the item at the front of the queue,
+// or returns ErrEmpty if the queue is empty.
+func (dq *DedupQueue[T, K]) Pop(timeout ...time.Duration) (T, error) {
+	for {
+		entry, err := dq.deque.PopFront()
+		if err != nil {
+			return entry.item, err
+		}
+		if dq.pending[entry.key] == entry.seq {
+			delete(dq.pending, entry.key)
+			return entry.item, nil
+		}
+	}
+}
+
+// Contains reports whether the item, or one with the same key, is pending.
+func (dq *DedupQueue[T, K]) Contains(item T) bool {
+	_, ok := dq.pending[dq.key(item)]
+	return ok
+}
+
+// compact drops the stale entries once they outnumber the pending ones,
+// so that moving items to the back again and again takes bounded memory.
+func (dq *DedupQueue[T, K]) compact() {
+	if dq.deque.Len() <= 2*len(dq.pending)+minDequeCapacity {
+		return
+	}
+	var deque Deque[dedupentry[T, K]]
+	for !dq.deque.Empty() {
+		entry, _ := dq.deque.PopFront()
+		if dq.pending[entry.key] == entry.seq {
+			deque.PushBack(entry)
+		}
+	}
+	dq.deque = deque
+}
+
+// Len returns the number of pending items.
+func (dq *DedupQueue[T, K]) Len() int {
+	return len(dq.pending)
+}
+
+// Empty returns whether the queue is empty.
+func (dq *DedupQueue[T, K]) Empty() bool {
+	return len(dq.pending) == 0
+}
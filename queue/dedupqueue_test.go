@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupQueueKeep(t *testing.T) {
+	dq := NewDedupQueue[string](DedupKeep)
+
+	for _, key := range []string{"a", "b", "a", "c", "b", "a"} {
+		assert.Nil(t, dq.Push(key))
+	}
+	assert.Equal(t, 3, dq.Len())
+	assert.True(t, dq.Contains("a"))
+
+	val, err := dq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, "a", val)
+	assert.False(t, dq.Contains("a"))
+
+	// once popped, an item can be pushed again
+	dq.Push("a")
+	for _, key := range []string{"b", "c", "a"} {
+		val, err = dq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, key, val)
+	}
+	_, err = dq.Pop()
+	assert.Equal(t, ErrEmpty, err)
+	assert.True(t, dq.Empty())
+}
+
+func TestDedupQueueMoveToBack(t *testing.T) {
+	dq := NewDedupQueue[string](DedupMoveToBack)
+
+	for _, key := range []string{"a", "b", "a", "c", "b", "a"} {
+		dq.Push(key)
+	}
+	assert.Equal(t, 3, dq.Len())
+	for _, key := range []string{"c", "b", "a"} {
+		val, err := dq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, key, val)
+	}
+	assert.True(t, dq.Empty())
+
+	// stale entries do not pile up
+	for i := 0; i < 1000; i++ {
+		dq.Push("a")
+		dq.Push("b")
+	}
+	assert.Equal(t, 2, dq.Len())
+	assert.True(t, dq.deque.Len() <= 2*2+minDequeCapacity)
+}
+
+type invalidation struct {
+	key  string
+	tags []string // makes the struct not comparable
+}
+
+func TestDedupQueueFunc(t *testing.T) {
+	dq := NewDedupQueueFunc(DedupMoveToBack, func(item invalidation) string {
+		return item.key
+	})
+
+	dq.Push(invalidation{key: "user:1", tags: []string{"old"}})
+	dq.Push(invalidation{key: "user:2"})
+	dq.Push(invalidation{key: "user:1", tags: []string{"new"}})
+	assert.Equal(t, 2, dq.Len())
+	assert.True(t, dq.Contains(invalidation{key: "user:1"}))
+
+	val, err := dq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, "user:2", val.key)
+	val, err = dq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"new"}, val.tags)
+}
@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DelayQueue is a queue of items that can only be popped once their ready
+// time has come, in order of ready time. It is safe for concurrent use.
+type DelayQueue[T any] struct {
+	mutex  sync.Mutex
+	pq     *PriorityQueue[delayed[T]]
+	wakeup chan struct{} // closed when the earliest ready time changes, if anyone waits
+}
+
+type delayed[T any] struct {
+	item T
+	at   time.Time
+}
+
+func NewDelayQueue[T any]() *DelayQueue[T] {
+	return &DelayQueue[T]{
+		pq: NewStablePriorityQueue(func(a, b delayed[T]) bool {
+			return a.at.Before(b.at)
+		}),
+	}
+}
+
+// Push adds the item to the queue, to become poppable at the time at.
+// Items with the same ready time are popped in the order they were pushed.
+func (dq *DelayQueue[T]) Push(item T, at time.Time) {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+	head, err := dq.pq.Peek()
+	earliest := err != nil || at.Before(head.at)
+	dq.pq.Push(delayed[T]{item: item, at: at})
+	if earliest {
+		broadcast(&dq.wakeup)
+	}
+}
+
+// Pop will return the item with the earliest ready time, once it is ready.
+// If no item is ready, block until one is. If a nonzero timeout is specified,
+// block no more than the timeout duration and return ErrTimeout. If timeout
+// is zero, immediately return ErrEmpty.
+func (dq *DelayQueue[T]) Pop(timeout ...time.Duration) (T, error) {
+	return dq.pop(context.Background(), timeout...)
+}
+
+// PopContext will return the item with the earliest ready time, once it is
+// ready. If no item is ready, block until one is or ctx is done, in which
+// case ctx.Err() is returned.
+func (dq *DelayQueue[T]) PopContext(ctx context.Context) (T, error) {
+	return dq.pop(ctx)
+}
+
+func (dq *DelayQueue[T]) pop(ctx context.Context, timeout ...time.Duration) (T, error) {
+	var zero T
+	var deadline time.Time
+	if len(timeout) > 0 && timeout[0] > 0 {
+		deadline = time.Now().Add(timeout[0])
+	}
+
+	dq.mutex.Lock()
+	for {
+		var wait time.Duration // until the earliest item is ready, or forever if 0
+		if head, err := dq.pq.Peek(); err == nil {
+			wait = time.Until(head.at)
+			if wait <= 0 {
+				d, _ := dq.pq.Pop()
+				dq.mutex.Unlock()
+				return d.item, nil
+			}
+		}
+		if len(timeout) > 0 && timeout[0] <= 0 {
+			dq.mutex.Unlock()
+			return zero, ErrEmpty
+		}
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				dq.mutex.Unlock()
+				return zero, ErrTimeout
+			}
+			if wait == 0 || remaining < wait {
+				wait = remaining
+			}
+		}
+
+		wakeup := waitFor(&dq.wakeup)
+		dq.mutex.Unlock()
+		if err := dq.wait(ctx, wakeup, wait); err != nil {
+			return zero, err
+		}
+		dq.mutex.Lock()
+	}
+}
+
+// wait blocks until wakeup is closed, ctx is done or, if d is positive,
+// d has elapsed. A nil error means the pop should retry.
+func (dq *DelayQueue[T]) wait(ctx context.Context, wakeup <-chan struct{}, d time.Duration) error {
+	var timeout <-chan time.Time
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-wakeup:
+	case <-timeout:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Len returns the number of items in the queue, whether ready or not.
+func (dq *DelayQueue[T]) Len() int {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+	return dq.pq.Len()
+}
+
+// Empty returns whether the queue is empty.
+func (dq *DelayQueue[T]) Empty() bool {
+	return dq.Len() == 0
+}
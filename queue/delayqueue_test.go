@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelayQueuePushPop(t *testing.T) {
+	dq := NewDelayQueue[int]()
+
+	assert.True(t, dq.Empty())
+	assert.Zero(t, dq.Len())
+
+	now := time.Now()
+	dq.Push(3, now.Add(3*time.Millisecond))
+	dq.Push(1, now.Add(-time.Millisecond))
+	dq.Push(2, now.Add(2*time.Millisecond))
+	dq.Push(4, now.Add(3*time.Millisecond))
+	assert.Equal(t, 4, dq.Len())
+
+	val, err := dq.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+
+	val, err = dq.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+	assert.Zero(t, val)
+
+	for _, expected := range []int{2, 3, 4} {
+		val, err = dq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, expected, val)
+	}
+	assert.False(t, time.Now().Before(now.Add(3*time.Millisecond)))
+	assert.True(t, dq.Empty())
+}
+
+func TestDelayQueueTimeout(t *testing.T) {
+	dq := NewDelayQueue[int]()
+
+	val, err := dq.Pop(time.Millisecond)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Zero(t, val)
+
+	dq.Push(1, time.Now().Add(10*time.Millisecond))
+	val, err = dq.Pop(time.Millisecond)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Zero(t, val)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	val, err = dq.PopContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Zero(t, val)
+
+	val, err = dq.PopContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+}
+
+func TestDelayQueueWakeEarly(t *testing.T) {
+	dq := NewDelayQueue[int]()
+	dq.Push(2, time.Now().Add(time.Second))
+
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		dq.Push(1, time.Now().Add(time.Millisecond))
+	}()
+
+	start := time.Now()
+	val, err := dq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, 1, dq.Len())
+}
+
+func TestDelayQueueConcurrent(t *testing.T) {
+	const items = 100
+	dq := NewDelayQueue[int]()
+
+	now := time.Now()
+	for i := 0; i < items; i++ {
+		dq.Push(i, now.Add(time.Duration(i%10)*time.Millisecond))
+	}
+
+	seen := make([]bool, items)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for c := 0; c < 4; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				val, err := dq.Pop(20 * time.Millisecond)
+				if err == ErrTimeout {
+					return
+				}
+				assert.Nil(t, err)
+				mu.Lock()
+				assert.False(t, seen[val])
+				seen[val] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, ok := range seen {
+		assert.True(t, ok)
+	}
+}
@@ -0,0 +1,142 @@
+package queue
+
+// minDequeCapacity is the smallest capacity of the ring buffer of a Deque.
+// It must be a power of 2.
+const minDequeCapacity = 16
+
+// Deque is an unbounded double-ended queue backed by a ring buffer that
+// grows and shrinks by powers of 2. It is not safe for concurrent use.
+type Deque[T any] struct {
+	buf   []T
+	head  int // index of the front item in buf
+	count int
+	min   int // capacity that the ring buffer never shrinks below
+}
+
+// NewDeque will allocate a Deque. The zero value of Deque is also an empty
+// deque ready to use. If a sizeHint is specified, room for that many items
+// is allocated up front, and the deque never shrinks below it.
+func NewDeque[T any](sizeHint ...int) *Deque[T] {
+	d := &Deque[T]{}
+	if len(sizeHint) > 0 && sizeHint[0] > minDequeCapacity {
+		d.buf = make([]T, roundUp(uint64(sizeHint[0])))
+		d.min = len(d.buf)
+	}
+	return d
+}
+
+// PushFront adds the item to the front of the deque.
+func (d *Deque[T]) PushFront(item T) {
+	d.grow()
+	d.head = (d.head - 1) & (len(d.buf) - 1)
+	d.buf[d.head] = item
+	d.count++
+}
+
+// PushBack adds the item to the back of the deque.
+func (d *Deque[T]) PushBack(item T) {
+	d.grow()
+	d.buf[(d.head+d.count)&(len(d.buf)-1)] = item
+	d.count++
+}
+
+// PopFront removes and returns the item at the front of the deque,
+// or returns ErrEmpty if the deque is empty.
+func (d *Deque[T]) PopFront() (T, error) {
+	var zero T
+	if d.count == 0 {
+		return zero, ErrEmpty
+	}
+	item := d.buf[d.head]
+	d.buf[d.head] = zero
+	d.head = (d.head + 1) & (len(d.buf) - 1)
+	d.count--
+	d.shrink()
+	return item, nil
+}
+
+// PopBack removes and returns the item at the back of the deque,
+// or returns ErrEmpty if the deque is empty.
+func (d *Deque[T]) PopBack() (T, error) {
+	var zero T
+	if d.count == 0 {
+		return zero, ErrEmpty
+	}
+	i := (d.head + d.count - 1) & (len(d.buf) - 1)
+	item := d.buf[i]
+	d.buf[i] = zero
+	d.count--
+	d.shrink()
+	return item, nil
+}
+
+// PeekFront returns the item at the front of the deque without removing it,
+// or returns ErrEmpty if the deque is empty.
+func (d *Deque[T]) PeekFront() (T, error) {
+	if d.count == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return d.buf[d.head], nil
+}
+
+// PeekBack returns the item at the back of the deque without removing it,
+// or returns ErrEmpty if the deque is empty.
+func (d *Deque[T]) PeekBack() (T, error) {
+	if d.count == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return d.buf[(d.head+d.count-1)&(len(d.buf)-1)], nil
+}
+
+// At returns the i-th item from the front of the deque, where the front item
+// is at 0 and the back item at Len()-1. It panics if i is out of range.
+func (d *Deque[T]) At(i int) T {
+	if i < 0 || i >= d.count {
+		panic("Deque index out of range")
+	}
+	return d.buf[(d.head+i)&(len(d.buf)-1)]
+}
+
+// Len returns the number of items in the deque.
+func (d *Deque[T]) Len() int {
+	return d.count
+}
+
+// Empty returns whether the deque is empty.
+func (d *Deque[T]) Empty() bool {
+	return d.count == 0
+}
+
+// grow doubles the ring buffer if it is full.
+func (d *Deque[T]) grow() {
+	if d.buf == nil {
+		d.buf = make([]T, minDequeCapacity)
+		return
+	}
+	if d.count == len(d.buf) {
+		d.resize(len(d.buf) << 1)
+	}
+}
+
+// shrink halves the ring buffer if it is no more than a quarter full.
+func (d *Deque[T]) shrink() {
+	if len(d.buf) > minDequeCapacity && len(d.buf) > d.min && d.count <= len(d.buf)>>2 {
+		d.resize(len(d.buf) >> 1)
+	}
+}
+
+// resize moves the items to a new ring buffer of the given capacity,
+// with the front item at index 0.
+func (d *Deque[T]) resize(capacity int) {
+	buf := make([]T, capacity)
+	if d.head+d.count <= len(d.buf) {
+		copy(buf, d.buf[d.head:d.head+d.count])
+	} else {
+		n := copy(buf, d.buf[d.head:])
+		copy(buf[n:], d.buf[:d.count-n])
+	}
+	d.buf = buf
+	d.head = 0
+}
@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDequePushPop(t *testing.T) {
+	var d Deque[int]
+
+	assert.True(t, d.Empty())
+	assert.Zero(t, d.Len())
+
+	d.PushBack(2)
+	d.PushFront(1)
+	d.PushBack(3)
+	assert.Equal(t, 3, d.Len())
+
+	val, err := d.PeekFront()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	val, err = d.PeekBack()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+	assert.Equal(t, 1, d.At(0))
+	assert.Equal(t, 2, d.At(1))
+	assert.Equal(t, 3, d.At(2))
+	assert.Panics(t, func() { d.At(3) })
+	assert.Panics(t, func() { d.At(-1) })
+
+	val, err = d.PopBack()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+	val, err = d.PopFront()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	val, err = d.PopFront()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+
+	for _, f := range []func() (int, error){d.PopFront, d.PopBack, d.PeekFront, d.PeekBack} {
+		val, err = f()
+		assert.Equal(t, ErrEmpty, err)
+		assert.Zero(t, val)
+	}
+}
+
+func TestDequeGrowShrink(t *testing.T) {
+	d := NewDeque[int]()
+	const n = 1000
+
+	// wrap the ring buffer around before growing it
+	for i := 0; i < 10; i++ {
+		d.PushBack(-1)
+		d.PopFront()
+	}
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			d.PushBack(i)
+		} else {
+			d.PushFront(i)
+		}
+	}
+	assert.Equal(t, n, d.Len())
+	assert.Equal(t, 1024, len(d.buf))
+
+	for i := 0; i < n; i++ {
+		if i < n/2 {
+			assert.Equal(t, n-1-2*i, d.At(i))
+		} else {
+			assert.Equal(t, 2*i-n, d.At(i))
+		}
+	}
+
+	for i := n - 2; i >= 0; i -= 2 {
+		val, err := d.PopBack()
+		assert.Nil(t, err)
+		assert.Equal(t, i, val)
+	}
+	for i := n - 1; i >= 0; i -= 2 {
+		val, err := d.PopFront()
+		assert.Nil(t, err)
+		assert.Equal(t, i, val)
+	}
+	assert.True(t, d.Empty())
+	assert.Equal(t, minDequeCapacity, len(d.buf))
+
+	d = NewDeque[int](100)
+	assert.Equal(t, 128, len(d.buf))
+	d.PushBack(1)
+	d.PopBack()
+	assert.Equal(t, 128, len(d.buf))
+}
+
+func BenchmarkDequePushBack(b *testing.B) {
+	d := NewDeque[int]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.PushBack(i)
+	}
+}
+
+func BenchmarkDequePushPopFront(b *testing.B) {
+	d := NewDeque[int]()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.PushFront(i)
+		if i%2 == 1 {
+			d.PopFront()
+		}
+	}
+}
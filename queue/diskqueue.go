@@ -0,0 +1,594 @@
+package queue
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCorrupt is returned by NewDiskQueue when the files of the queue are
+// damaged beyond what crash recovery repairs.
+var ErrCorrupt = errors.New("queue corrupt")
+
+// RecordError is returned by DiskQueue.Pop when the item at the front of the
+// queue cannot be read or decoded. The item is skipped, so that the next pop
+// moves on. If the record itself is damaged, the items after it in the same
+// segment cannot be located, and are skipped as well.
+type RecordError struct {
+	Segment uint64 // the segment file of the record
+	Offset  int64  // the position of the record in the segment
+	Err     error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("queue record at %d of segment %d: %v", e.Offset, e.Segment, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// Codec encodes and decodes the items of a DiskQueue.
+type Codec[T any] interface {
+	Encode(item T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec encodes items with encoding/json.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(item T) ([]byte, error) {
+	return json.Marshal(item)
+}
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var item T
+	err := json.Unmarshal(data, &item)
+	return item, err
+}
+
+// SyncPolicy determines when a DiskQueue fsyncs its files.
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs after every push and pop, along with the directory
+	// when segments are created or deleted, so that no acknowledged
+	// operation is lost, at the price of throughput.
+	SyncAlways SyncPolicy = iota
+	// SyncPeriodic fsyncs on a push or pop once SyncInterval has elapsed
+	// since the last fsync, and every SyncInterval in the background while
+	// the queue is idle, so that a crash loses at most that much.
+	SyncPeriodic
+	// SyncNever leaves flushing to the operating system until Close.
+	SyncNever
+)
+
+// DiskQueueOptions configures a DiskQueue. Zero fields take their defaults.
+type DiskQueueOptions struct {
+	// SegmentSize is the size in bytes past which a new segment file is
+	// started. Defaults to 64 MiB.
+	SegmentSize int64
+	// Sync is the fsync policy. Defaults to SyncAlways.
+	Sync SyncPolicy
+	// SyncInterval is the period of SyncPeriodic. Defaults to 1s.
+	SyncInterval time.Duration
+}
+
+const (
+	defaultSegmentSize  = 64 << 20
+	defaultSyncInterval = time.Second
+
+	segmentExt   = ".seg"
+	offsetFile   = "offset"
+	recordHeader = 8  // length and CRC of the data
+	offsetSize   = 20 // segment, position and CRC
+)
+
+// DiskQueue is a durable FIFO queue that stores its items in a directory.
+// Pushed items are appended to segment files, while the position of the
+// next item to pop is kept in an offset file. On opening, a record torn by
+// a crash at the end of the last segment is truncated, and segments are
+// deleted once all their items are popped. Delivery is at least once:
+// items popped since the last fsync of the offset are popped again after
+// a crash. It is safe for concurrent use, and never blocks.
+type DiskQueue[T any] struct {
+	mutex    sync.Mutex
+	dir      string
+	codec    Codec[T]
+	options  DiskQueueOptions
+	segments []uint64 // sequence of the first item of each segment, in order
+	head     uint64   // sequence of the next item to pop
+	headPos  int64    // position of the next item to pop in the first segment
+	tail     uint64   // sequence of the next item to push
+	tailSize int64    // size of the last segment
+	reader   *os.File // the first segment
+	writer   *os.File // the last segment
+	offset   *os.File
+	dirty    bool // whether there are writes to fsync
+	dirDirty bool // whether there are segments created or deleted to fsync
+	lastSync time.Time
+	closed   bool
+	stop     chan struct{} // closed by Close to stop the flusher of SyncPeriodic
+}
+
+// NewDiskQueue opens the DiskQueue in the directory dir, creating it if
+// needed, and recovers the items left in it. The codec encodes the items.
+func NewDiskQueue[T any](dir string, codec Codec[T], options ...DiskQueueOptions) (*DiskQueue[T], error) {
+	dq := &DiskQueue[T]{
+		dir:      dir,
+		codec:    codec,
+		lastSync: time.Now(),
+	}
+	if len(options) > 0 {
+		dq.options = options[0]
+	}
+	if dq.options.SegmentSize <= 0 {
+		dq.options.SegmentSize = defaultSegmentSize
+	}
+	if dq.options.SyncInterval <= 0 {
+		dq.options.SyncInterval = defaultSyncInterval
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := dq.recover(); err != nil {
+		dq.closeFiles()
+		return nil, err
+	}
+	if dq.options.Sync == SyncPeriodic {
+		dq.stop = make(chan struct{})
+		go dq.flush()
+	}
+	return dq, nil
+}
+
+// recover loads the segments and the offset, repairing what a crash left.
+func (dq *DiskQueue[T]) recover() error {
+	if err := dq.listSegments(); err != nil {
+		return err
+	}
+	if len(dq.segments) == 0 {
+		dq.segments = []uint64{0}
+	}
+
+	var err error
+	dq.offset, err = os.OpenFile(filepath.Join(dq.dir, offsetFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	first, pos, ok := dq.readOffset()
+	if !ok || first < dq.segments[0] {
+		// the offset is lost, so deliver every remaining item again
+		first, pos = dq.segments[0], 0
+	}
+
+	// delete the segments that were consumed but not yet deleted
+	for len(dq.segments) > 1 && dq.segments[1] <= first {
+		if err := os.Remove(dq.segmentPath(dq.segments[0])); err != nil {
+			return err
+		}
+		dq.segments = dq.segments[1:]
+	}
+	if dq.segments[0] != first {
+		first, pos = dq.segments[0], 0
+	}
+
+	seq := dq.segments[0]
+	for i, segment := range dq.segments {
+		if segment != seq {
+			return fmt.Errorf("%w: segment %d does not follow item %d", ErrCorrupt, segment, seq)
+		}
+		last := i == len(dq.segments)-1
+		count, size, err := dq.scanSegment(segment, last)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			dq.head = segment
+			if !dq.seekHead(pos, size) {
+				// deliver the items of the segment again
+				dq.head, dq.headPos = segment, 0
+			}
+		}
+		seq += count
+		if last {
+			dq.tailSize = size
+		}
+	}
+	dq.tail = seq
+
+	if dq.reader, err = os.Open(dq.segmentPath(dq.segments[0])); err != nil {
+		return err
+	}
+	if err := dq.openWriter(); err != nil {
+		return err
+	}
+	return dq.syncDir()
+}
+
+// listSegments finds the segment files in the directory.
+func (dq *DiskQueue[T]) listSegments() error {
+	entries, err := os.ReadDir(dq.dir)
+	if err != nil {
+		return err
+	}
+	dq.segments = nil
+	for _, entry := range entries {
+		var segment uint64
+		name := entry.Name()
+		if filepath.Ext(name) != segmentExt {
+			continue
+		}
+		if _, err := fmt.Sscanf(name, "%020d"+segmentExt, &segment); err != nil {
+			continue
+		}
+		dq.segments = append(dq.segments, segment)
+	}
+	sort.Slice(dq.segments, func(i, j int) bool { return dq.segments[i] < dq.segments[j] })
+	return nil
+}
+
+// scanSegment validates the records of a segment, and returns their count
+// and total size. A damaged record of the last segment, which a crash
+// tore while appending it, is truncated along with what follows.
+func (dq *DiskQueue[T]) scanSegment(segment uint64, last bool) (uint64, int64, error) {
+	f, err := os.OpenFile(dq.segmentPath(segment), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var count uint64
+	var pos int64
+	for pos < info.Size() {
+		_, n, err := readRecord(f, pos, info.Size())
+		if err != nil {
+			if !last {
+				return 0, 0, fmt.Errorf("%w: segment %d at %d: %v", ErrCorrupt, segment, pos, err)
+			}
+			if err := f.Truncate(pos); err != nil {
+				return 0, 0, err
+			}
+			break
+		}
+		pos += n
+		count++
+	}
+	return count, pos, nil
+}
+
+// seekHead moves the head to position pos of the first segment, of the
+// given size. It reports false if pos is not at a record boundary.
+func (dq *DiskQueue[T]) seekHead(pos, size int64) bool {
+	if pos > size {
+		return false
+	}
+	f, err := os.Open(dq.segmentPath(dq.segments[0]))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	for dq.headPos < pos {
+		_, n, err := readRecord(f, dq.headPos, size)
+		if err != nil {
+			return false
+		}
+		dq.headPos += n
+		dq.head++
+	}
+	return dq.headPos == pos
+}
+
+// readRecord reads the record at pos, which must end by the limit, and
+// returns its data and size.
+func readRecord(r io.ReaderAt, pos, limit int64) ([]byte, int64, error) {
+	var header [recordHeader]byte
+	if _, err := r.ReadAt(header[:], pos); err != nil {
+		return nil, 0, err
+	}
+	length := binary.LittleEndian.Uint32(header[0:4])
+	if pos+recordHeader+int64(length) > limit {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, length)
+	if _, err := r.ReadAt(data, pos+recordHeader); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, 0, errors.New("checksum mismatch")
+	}
+	return data, recordHeader + int64(len(data)), nil
+}
+
+// readOffset returns the first segment and the position of the head in
+// it, as last saved. It reports false if they were never saved or are torn.
+func (dq *DiskQueue[T]) readOffset() (uint64, int64, bool) {
+	var buf [offsetSize]byte
+	if _, err := dq.offset.ReadAt(buf[:], 0); err != nil {
+		return 0, 0, false
+	}
+	if crc32.ChecksumIEEE(buf[:16]) != binary.LittleEndian.Uint32(buf[16:20]) {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint64(buf[0:8]), int64(binary.LittleEndian.Uint64(buf[8:16])), true
+}
+
+func (dq *DiskQueue[T]) writeOffset() error {
+	var buf [offsetSize]byte
+	binary.LittleEndian.PutUint64(buf[0:8], dq.segments[0])
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(dq.headPos))
+	binary.LittleEndian.PutUint32(buf[16:20], crc32.ChecksumIEEE(buf[:16]))
+	_, err := dq.offset.WriteAt(buf[:], 0)
+	return err
+}
+
+func (dq *DiskQueue[T]) segmentPath(segment uint64) string {
+	return filepath.Join(dq.dir, fmt.Sprintf("%020d"+segmentExt, segment))
+}
+
+func (dq *DiskQueue[T]) openWriter() error {
+	var err error
+	dq.writer, err = os.OpenFile(dq.segmentPath(dq.segments[len(dq.segments)-1]), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	return err
+}
+
+// Push appends the item to the queue. As the queue is unbounded, the
+// timeout is ignored. If the queue is closed, return ErrClosed.
+func (dq *DiskQueue[T]) Push(item T, timeout ...time.Duration) error {
+	data, err := dq.codec.Encode(item)
+	if err != nil {
+		return err
+	}
+	record := make([]byte, recordHeader+len(data))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+	copy(record[recordHeader:], data)
+
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	if dq.closed {
+		return ErrClosed
+	}
+	if dq.tailSize > 0 && dq.tailSize+int64(len(record)) > dq.options.SegmentSize {
+		if err := dq.roll(); err != nil {
+			return err
+		}
+	}
+	if _, err := dq.writer.Write(record); err != nil {
+		// drop what may have been written, so as not to leave a torn record
+		dq.writer.Truncate(dq.tailSize)
+		return err
+	}
+	dq.tailSize += int64(len(record))
+	dq.tail++
+	dq.dirty = true
+	return dq.maybeSync()
+}
+
+// roll starts a new segment for the items pushed from now on.
+func (dq *DiskQueue[T]) roll() error {
+	if dq.dirty {
+		// items must not outlive the segment before them
+		if err := dq.writer.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := dq.writer.Close(); err != nil {
+		return err
+	}
+	dq.segments = append(dq.segments, dq.tail)
+	dq.tailSize = 0
+	dq.dirDirty = true
+	return dq.openWriter()
+}
+
+// Pop removes and returns the item at the front of the queue, or returns
+// ErrEmpty if the queue is empty. The timeout is ignored. If the queue is
+// closed, return ErrClosed.
+func (dq *DiskQueue[T]) Pop(timeout ...time.Duration) (T, error) {
+	var zero T
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	if dq.closed {
+		return zero, ErrClosed
+	}
+	if dq.head == dq.tail {
+		return zero, ErrEmpty
+	}
+	if len(dq.segments) > 1 && dq.head == dq.segments[1] {
+		if err := dq.advance(); err != nil {
+			return zero, err
+		}
+	}
+
+	segment, pos := dq.segments[0], dq.headPos
+	var item T
+	data, n, err := readRecord(dq.reader, pos, math.MaxInt64)
+	if err == nil {
+		item, err = dq.codec.Decode(data)
+		dq.head++
+		dq.headPos += n
+	} else if serr := dq.skipSegment(); serr != nil {
+		return zero, serr
+	}
+	if werr := dq.writeOffset(); werr != nil {
+		return zero, werr
+	}
+	dq.dirty = true
+	if serr := dq.maybeSync(); serr != nil {
+		return zero, serr
+	}
+	if err != nil {
+		return zero, &RecordError{Segment: segment, Offset: pos, Err: err}
+	}
+	return item, nil
+}
+
+// skipSegment moves the head past the remaining items of the first segment.
+func (dq *DiskQueue[T]) skipSegment() error {
+	if len(dq.segments) > 1 {
+		dq.head = dq.segments[1]
+		return dq.advance()
+	}
+	dq.head, dq.headPos = dq.tail, dq.tailSize
+	return nil
+}
+
+// advance moves the head to the next segment, and deletes the first one.
+func (dq *DiskQueue[T]) advance() error {
+	next, err := os.Open(dq.segmentPath(dq.segments[1]))
+	if err != nil {
+		return err
+	}
+	consumed := dq.segmentPath(dq.segments[0])
+	dq.reader.Close()
+	dq.reader = next
+	dq.segments = dq.segments[1:]
+	dq.headPos = 0
+	if err := dq.writeOffset(); err != nil {
+		return err
+	}
+	dq.dirDirty = true
+	return os.Remove(consumed)
+}
+
+// maybeSync fsyncs the files as the policy demands.
+func (dq *DiskQueue[T]) maybeSync() error {
+	switch dq.options.Sync {
+	case SyncAlways:
+		return dq.sync()
+	case SyncPeriodic:
+		if time.Since(dq.lastSync) >= dq.options.SyncInterval {
+			return dq.sync()
+		}
+	}
+	return nil
+}
+
+func (dq *DiskQueue[T]) sync() error {
+	if !dq.dirty {
+		return nil
+	}
+	if err := dq.writer.Sync(); err != nil {
+		return err
+	}
+	if err := dq.offset.Sync(); err != nil {
+		return err
+	}
+	if dq.dirDirty {
+		if err := dq.syncDir(); err != nil {
+			return err
+		}
+	}
+	dq.dirty = false
+	dq.lastSync = time.Now()
+	return nil
+}
+
+// flush fsyncs the writes of SyncPeriodic every interval until the queue is
+// closed, so that they are not left unsynced while no push or pop comes.
+// A failed fsync is retried by the next push, pop or flush.
+func (dq *DiskQueue[T]) flush() {
+	ticker := time.NewTicker(dq.options.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-dq.stop:
+			return
+		case <-ticker.C:
+		}
+		dq.mutex.Lock()
+		if !dq.closed {
+			dq.sync()
+		}
+		dq.mutex.Unlock()
+	}
+}
+
+// syncDir fsyncs the directory, so that the segments created or deleted
+// in it survive a crash.
+func (dq *DiskQueue[T]) syncDir() error {
+	d, err := os.Open(dq.dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return err
+	}
+	dq.dirDirty = false
+	return nil
+}
+
+// Sync fsyncs the files of the queue, whatever the policy.
+func (dq *DiskQueue[T]) Sync() error {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	if dq.closed {
+		return ErrClosed
+	}
+	return dq.sync()
+}
+
+// Close fsyncs and closes the files of the queue, and stops the background
+// fsyncs of SyncPeriodic. Further pushes and pops return ErrClosed. Close is
+// idempotent.
+func (dq *DiskQueue[T]) Close() error {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	if dq.closed {
+		return nil
+	}
+	dq.closed = true
+	if dq.stop != nil {
+		close(dq.stop)
+	}
+	err := dq.sync()
+	if cerr := dq.closeFiles(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (dq *DiskQueue[T]) closeFiles() error {
+	var err error
+	for _, f := range []*os.File{dq.reader, dq.writer, dq.offset} {
+		if f != nil {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
+
+// Len returns the number of items in the queue.
+func (dq *DiskQueue[T]) Len() int {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+	return int(dq.tail - dq.head)
+}
+
+// Empty returns whether the queue is empty.
+func (dq *DiskQueue[T]) Empty() bool {
+	return dq.Len() == 0
+}
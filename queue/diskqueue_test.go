@@ -0,0 +1,300 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskQueuePushPop(t *testing.T) {
+	dq, err := NewDiskQueue[int](t.TempDir(), JSONCodec[int]{})
+	assert.Nil(t, err)
+	defer dq.Close()
+
+	assert.True(t, dq.Empty())
+	_, err = dq.Pop()
+	assert.Equal(t, ErrEmpty, err)
+
+	for i := 1; i <= 100; i++ {
+		assert.Nil(t, dq.Push(i))
+	}
+	assert.Equal(t, 100, dq.Len())
+	for i := 1; i <= 100; i++ {
+		val, err := dq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, i, val)
+	}
+	assert.True(t, dq.Empty())
+
+	assert.Nil(t, dq.Close())
+	assert.Nil(t, dq.Close())
+	assert.Equal(t, ErrClosed, dq.Push(1))
+	_, err = dq.Pop()
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestDiskQueueReopen(t *testing.T) {
+	dir := t.TempDir()
+	options := DiskQueueOptions{SegmentSize: 64, Sync: SyncNever}
+
+	dq, err := NewDiskQueue[string](dir, JSONCodec[string]{}, options)
+	assert.Nil(t, err)
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, dq.Push(strconv.Itoa(i)))
+	}
+	for i := 0; i < 20; i++ {
+		val, err := dq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, strconv.Itoa(i), val)
+	}
+	assert.Nil(t, dq.Close())
+
+	// the queue goes on where it left off
+	dq, err = NewDiskQueue[string](dir, JSONCodec[string]{}, options)
+	assert.Nil(t, err)
+	assert.Equal(t, 30, dq.Len())
+	assert.Nil(t, dq.Push("50"))
+	for i := 20; i <= 50; i++ {
+		val, err := dq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, strconv.Itoa(i), val)
+	}
+	assert.True(t, dq.Empty())
+	assert.Nil(t, dq.Close())
+}
+
+func TestDiskQueueSegmentGC(t *testing.T) {
+	dir := t.TempDir()
+	dq, err := NewDiskQueue[int](dir, JSONCodec[int]{}, DiskQueueOptions{SegmentSize: 32})
+	assert.Nil(t, err)
+	defer dq.Close()
+
+	for i := 0; i < 100; i++ {
+		dq.Push(i)
+	}
+	segments := countSegments(t, dir)
+	assert.True(t, segments > 10)
+
+	for i := 0; i < 90; i++ {
+		dq.Pop()
+	}
+	assert.True(t, countSegments(t, dir) < segments/2)
+	for i := 90; i < 100; i++ {
+		val, err := dq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, i, val)
+	}
+	assert.Equal(t, 1, countSegments(t, dir))
+}
+
+func countSegments(t *testing.T, dir string) int {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	assert.Nil(t, err)
+	return len(matches)
+}
+
+func TestDiskQueueTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	dq, err := NewDiskQueue[int](dir, JSONCodec[int]{}, DiskQueueOptions{SegmentSize: 64})
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		dq.Push(i)
+	}
+	dq.Pop()
+	assert.Nil(t, dq.Close())
+
+	// simulate a crash in the middle of appending a record
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	last := matches[len(matches)-1]
+	f, err := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	f.Write([]byte{42, 0, 0, 0, 1, 2, 3, 4, '1'})
+	f.Close()
+	info, _ := os.Stat(last)
+	size := info.Size()
+
+	dq, err = NewDiskQueue[int](dir, JSONCodec[int]{}, DiskQueueOptions{SegmentSize: 64})
+	assert.Nil(t, err)
+	defer dq.Close()
+	info, _ = os.Stat(last)
+	assert.Equal(t, size-9, info.Size())
+
+	assert.Equal(t, 19, dq.Len())
+	dq.Push(20)
+	for i := 1; i <= 20; i++ {
+		val, err := dq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, i, val)
+	}
+}
+
+func TestDiskQueueLostOffset(t *testing.T) {
+	dir := t.TempDir()
+	dq, err := NewDiskQueue[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		dq.Push(i)
+	}
+	dq.Pop()
+	dq.Pop()
+	assert.Nil(t, dq.Close())
+
+	// a torn offset makes the remaining items be delivered again
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, offsetFile), []byte("torn"), 0644))
+	dq, err = NewDiskQueue[int](dir, JSONCodec[int]{})
+	assert.Nil(t, err)
+	defer dq.Close()
+	assert.Equal(t, 5, dq.Len())
+	val, err := dq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, val)
+}
+
+func TestDiskQueueCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	dq, err := NewDiskQueue[int](dir, JSONCodec[int]{}, DiskQueueOptions{SegmentSize: 32})
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		dq.Push(i)
+	}
+	assert.Nil(t, dq.Close())
+
+	// damage in a segment other than the last is not a torn write
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	assert.Nil(t, os.WriteFile(matches[1], []byte("garbage!garbage!"), 0644))
+	_, err = NewDiskQueue[int](dir, JSONCodec[int]{})
+	assert.True(t, errors.Is(err, ErrCorrupt))
+}
+
+func TestDiskQueueSyncPeriodicIdle(t *testing.T) {
+	dq, err := NewDiskQueue[int](t.TempDir(), JSONCodec[int]{}, DiskQueueOptions{Sync: SyncPeriodic, SyncInterval: 5 * time.Millisecond})
+	assert.Nil(t, err)
+	defer dq.Close()
+	dq.Push(1)
+
+	// the push is fsynced while the queue is idle
+	assert.Eventually(t, func() bool {
+		dq.mutex.Lock()
+		defer dq.mutex.Unlock()
+		return !dq.dirty
+	}, time.Second, time.Millisecond)
+}
+
+func TestDiskQueueDamagedRecord(t *testing.T) {
+	dir := t.TempDir()
+	dq, err := NewDiskQueue[int](dir, JSONCodec[int]{}, DiskQueueOptions{SegmentSize: 20})
+	assert.Nil(t, err)
+	defer dq.Close()
+	for i := 10; i < 16; i++ {
+		dq.Push(i) // two records of 10 bytes per segment
+	}
+	assert.Equal(t, 3, countSegments(t, dir))
+
+	// damage the second record of the first segment after the queue opened it
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	f, err := os.OpenFile(matches[0], os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	f.WriteAt([]byte("x"), 18)
+	f.Close()
+
+	val, err := dq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 10, val)
+	_, err = dq.Pop()
+	var recordErr *RecordError
+	assert.True(t, errors.As(err, &recordErr))
+	assert.Equal(t, uint64(0), recordErr.Segment)
+	assert.EqualValues(t, 10, recordErr.Offset)
+
+	// the queue moves on to the next segment
+	assert.Equal(t, 4, dq.Len())
+	assert.Equal(t, 2, countSegments(t, dir))
+	val, err = dq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 12, val)
+}
+
+// bangCodec is a Codec that rejects empty strings and marks decoded ones.
+type bangCodec struct{}
+
+func (bangCodec) Encode(item string) ([]byte, error) {
+	if item == "" {
+		return nil, errors.New("empty item")
+	}
+	return []byte(item), nil
+}
+
+func (bangCodec) Decode(data []byte) (string, error) {
+	return string(data) + "!", nil
+}
+
+func TestDiskQueueCodec(t *testing.T) {
+	dq, err := NewDiskQueue[string](t.TempDir(), bangCodec{}, DiskQueueOptions{Sync: SyncPeriodic, SyncInterval: time.Millisecond})
+	assert.Nil(t, err)
+	defer dq.Close()
+
+	assert.NotNil(t, dq.Push(""))
+	assert.True(t, dq.Empty())
+	assert.Nil(t, dq.Push("hi"))
+	time.Sleep(2 * time.Millisecond)
+	assert.Nil(t, dq.Push("there"))
+	assert.Nil(t, dq.Sync())
+
+	val, err := dq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, "hi!", val)
+	val, err = dq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, "there!", val)
+}
+
+// oddCodec is a JSONCodec that fails to decode odd numbers.
+type oddCodec struct {
+	JSONCodec[int]
+}
+
+func (c oddCodec) Decode(data []byte) (int, error) {
+	item, err := c.JSONCodec.Decode(data)
+	if err == nil && item%2 != 0 {
+		return 0, errors.New("odd item")
+	}
+	return item, err
+}
+
+func TestDiskQueueDecodeError(t *testing.T) {
+	dq, err := NewDiskQueue[int](t.TempDir(), oddCodec{})
+	assert.Nil(t, err)
+	defer dq.Close()
+	for i := 0; i < 3; i++ {
+		dq.Push(i)
+	}
+
+	dq.Pop()
+	_, err = dq.Pop()
+	var recordErr *RecordError
+	assert.True(t, errors.As(err, &recordErr))
+	assert.EqualValues(t, recordHeader+1, recordErr.Offset)
+	assert.EqualError(t, recordErr.Unwrap(), "odd item")
+
+	// only the item that failed to decode is skipped
+	val, err := dq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+	assert.True(t, dq.Empty())
+}
+
+func BenchmarkDiskQueuePushPop(b *testing.B) {
+	dq, _ := NewDiskQueue[int](b.TempDir(), JSONCodec[int]{}, DiskQueueOptions{Sync: SyncNever})
+	defer dq.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dq.Push(i)
+		dq.Pop()
+	}
+}
@@ -0,0 +1,324 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNoQueue is returned when pushing to a sub-queue that does not exist.
+var ErrNoQueue = errors.New("queue not found")
+
+// FairPolicy determines how a FairQueue shares pops among its sub-queues.
+type FairPolicy int
+
+const (
+	// WeightedRoundRobin visits the non-empty sub-queues in turn, popping
+	// up to weight items from each.
+	WeightedRoundRobin FairPolicy = iota
+	// DeficitRoundRobin visits the non-empty sub-queues in turn, crediting
+	// each with weight units of cost per turn, and popping items while
+	// their cost is covered by the credit. The unused credit of a sub-queue
+	// is carried over to its next turn as long as it is not empty, so that
+	// sub-queues get shares of the cost, not of the number of items,
+	// proportional to their weights.
+	DeficitRoundRobin
+)
+
+// SubQueue is a queue that a FairQueue shares pops among, like Queue or
+// PriorityQueue. It must not block.
+type SubQueue[T any] interface {
+	Interface[T]
+	Peek() (T, error)
+}
+
+var (
+	_ SubQueue[int] = (*Queue[int])(nil)
+	_ SubQueue[int] = (*PriorityQueue[int])(nil)
+)
+
+// FairQueue holds named sub-queues, say one per tenant, and pops from them
+// in turn by their weights, so that a busy sub-queue does not starve the
+// others. It is safe for concurrent use, with the blocking Pop of
+// ChannelQueue and RingQueue.
+type FairQueue[T any] struct {
+	mutex    sync.Mutex
+	policy   FairPolicy
+	cost     func(item T) int
+	subs     map[string]*fairsub[T]
+	order    []*fairsub[T] // the sub-queues in the order of their turns
+	current  int           // index in order of the sub-queue whose turn it is
+	started  bool          // whether the turn of the current sub-queue started
+	notEmpty chan struct{} // closed when an item is pushed, if anyone waits
+	done     chan struct{}
+	closer   sync.Once
+}
+
+type fairsub[T any] struct {
+	name   string
+	q      SubQueue[T]
+	weight int
+	credit int // what is left of the turn: items or cost
+}
+
+// NewFairQueue will allocate a FairQueue with the policy. With
+// DeficitRoundRobin, cost returns the cost of an item, e.g. its size or
+// expected processing time; it defaults to 1 for every item. A cost below 1
+// counts as 1, so that free items cannot keep the turn forever.
+func NewFairQueue[T any](policy FairPolicy, cost ...func(item T) int) *FairQueue[T] {
+	fq := &FairQueue[T]{
+		policy: policy,
+		subs:   make(map[string]*fairsub[T]),
+		done:   make(chan struct{}),
+	}
+	if len(cost) > 0 {
+		fq.cost = cost[0]
+	}
+	return fq
+}
+
+// AddQueue adds the sub-queue q under the name with the weight, which
+// must be positive. Once added, q must only be used through the FairQueue.
+// It reports false if the name is already taken.
+func (fq *FairQueue[T]) AddQueue(name string, q SubQueue[T], weight int) bool {
+	if weight <= 0 {
+		panic("FairQueue weight must be greater than 0")
+	}
+	fq.mutex.Lock()
+	defer fq.mutex.Unlock()
+
+	if _, ok := fq.subs[name]; ok {
+		return false
+	}
+	sub := &fairsub[T]{name: name, q: q, weight: weight}
+	fq.subs[name] = sub
+	fq.order = append(fq.order, sub)
+	if !q.Empty() {
+		broadcast(&fq.notEmpty)
+	}
+	return true
+}
+
+// RemoveQueue removes the sub-queue of the name, along with its items,
+// and returns it. It reports false if there is no such sub-queue.
+func (fq *FairQueue[T]) RemoveQueue(name string) (SubQueue[T], bool) {
+	fq.mutex.Lock()
+	defer fq.mutex.Unlock()
+
+	sub, ok := fq.subs[name]
+	if !ok {
+		return nil, false
+	}
+	delete(fq.subs, name)
+	for i, other := range fq.order {
+		if other == sub {
+			fq.order = append(fq.order[:i], fq.order[i+1:]...)
+			if i < fq.current {
+				fq.current--
+			} else if i == fq.current {
+				fq.started = false
+			}
+			break
+		}
+	}
+	if fq.current >= len(fq.order) {
+		fq.current = 0
+	}
+	return sub.q, true
+}
+
+// SetWeight changes the weight of the sub-queue of the name, which must be
+// positive, from its next turn on. It reports false if there is no such
+// sub-queue.
+func (fq *FairQueue[T]) SetWeight(name string, weight int) bool {
+	if weight <= 0 {
+		panic("FairQueue weight must be greater than 0")
+	}
+	fq.mutex.Lock()
+	defer fq.mutex.Unlock()
+
+	sub, ok := fq.subs[name]
+	if ok {
+		sub.weight = weight
+	}
+	return ok
+}
+
+// Push adds the item to the sub-queue of the name. It never blocks. If there
+// is no such sub-queue, return ErrNoQueue. If the queue is closed, return
+// ErrClosed.
+func (fq *FairQueue[T]) Push(name string, item T) error {
+	fq.mutex.Lock()
+	defer fq.mutex.Unlock()
+
+	if fq.IsClosed() {
+		return ErrClosed
+	}
+	sub, ok := fq.subs[name]
+	if !ok {
+		return ErrNoQueue
+	}
+	if err := sub.q.Push(item); err != nil {
+		return err
+	}
+	broadcast(&fq.notEmpty)
+	return nil
+}
+
+// Pop will return the next item by the policy. If all sub-queues are empty,
+// block until an item is pushed. If a nonzero timeout is specified, block no
+// more than the timeout duration and return ErrTimeout. If timeout is zero,
+// immediately return ErrEmpty. Once the queue is closed, the remaining items
+// are still returned, after which ErrClosed is returned.
+func (fq *FairQueue[T]) Pop(timeout ...time.Duration) (T, error) {
+	return fq.pop(context.Background(), timeout...)
+}
+
+// PopContext will return the next item by the policy. If all sub-queues are
+// empty, block until an item is pushed or ctx is done, in which case
+// ctx.Err() is returned. Once the queue is closed, the remaining items are
+// still returned, after which ErrClosed is returned.
+func (fq *FairQueue[T]) PopContext(ctx context.Context) (T, error) {
+	return fq.pop(ctx)
+}
+
+func (fq *FairQueue[T]) pop(ctx context.Context, timeout ...time.Duration) (T, error) {
+	var zero T
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	fq.mutex.Lock()
+	for {
+		if item, ok := fq.next(); ok {
+			fq.mutex.Unlock()
+			return item, nil
+		}
+		if fq.IsClosed() {
+			fq.mutex.Unlock()
+			return zero, ErrClosed
+		}
+		if len(timeout) > 0 && timeout[0] <= 0 {
+			fq.mutex.Unlock()
+			return zero, ErrEmpty
+		}
+		if len(timeout) > 0 && timer == nil {
+			timer = time.NewTimer(timeout[0])
+		}
+
+		notEmpty := waitFor(&fq.notEmpty)
+		fq.mutex.Unlock()
+		if err := fq.wait(ctx, notEmpty, timer); err != nil {
+			return zero, err
+		}
+		fq.mutex.Lock()
+	}
+}
+
+// next pops the next item by the policy, if any sub-queue has one.
+// It must be called with the lock held.
+func (fq *FairQueue[T]) next() (T, bool) {
+	var zero T
+	if fq.len() == 0 {
+		return zero, false
+	}
+	for {
+		sub := fq.order[fq.current]
+		if sub.q.Empty() {
+			sub.credit = 0
+			fq.advance()
+			continue
+		}
+		if !fq.started {
+			fq.started = true
+			if fq.policy == DeficitRoundRobin {
+				sub.credit += sub.weight
+			} else {
+				sub.credit = sub.weight
+			}
+		}
+
+		cost := 1
+		if fq.policy == DeficitRoundRobin && fq.cost != nil {
+			head, _ := sub.q.Peek()
+			if cost = fq.cost(head); cost < 1 {
+				cost = 1
+			}
+		}
+		if cost > sub.credit {
+			fq.advance()
+			continue
+		}
+		item, _ := sub.q.Pop()
+		sub.credit -= cost
+		if sub.credit == 0 || sub.q.Empty() {
+			if sub.q.Empty() {
+				sub.credit = 0
+			}
+			fq.advance()
+		}
+		return item, true
+	}
+}
+
+// advance ends the turn of the current sub-queue.
+func (fq *FairQueue[T]) advance() {
+	fq.current = (fq.current + 1) % len(fq.order)
+	fq.started = false
+}
+
+// wait blocks until ready is closed, the queue is closed, ctx is done
+// or the timer, if any, fires. A nil error means the operation should retry.
+func (fq *FairQueue[T]) wait(ctx context.Context, ready <-chan struct{}, timer *time.Timer) error {
+	var timeout <-chan time.Time
+	if timer != nil {
+		timeout = timer.C
+	}
+	select {
+	case <-ready:
+	case <-fq.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return ErrTimeout
+	}
+	return nil
+}
+
+// Close closes the queue and wakes up all blocked consumers. Further pushes
+// return ErrClosed, while pops keep returning the remaining items until the
+// queue is drained. Close is idempotent.
+func (fq *FairQueue[T]) Close() {
+	fq.closer.Do(func() {
+		close(fq.done)
+	})
+}
+
+// IsClosed reports whether the queue has been closed.
+func (fq *FairQueue[T]) IsClosed() bool {
+	return isDone(fq.done)
+}
+
+// Len returns the number of items in all sub-queues.
+func (fq *FairQueue[T]) Len() int {
+	fq.mutex.Lock()
+	defer fq.mutex.Unlock()
+	return fq.len()
+}
+
+func (fq *FairQueue[T]) len() int {
+	n := 0
+	for _, sub := range fq.order {
+		n += sub.q.Len()
+	}
+	return n
+}
+
+// Empty returns whether all sub-queues are empty.
+func (fq *FairQueue[T]) Empty() bool {
+	return fq.Len() == 0
+}
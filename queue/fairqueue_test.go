@@ -0,0 +1,164 @@
+package queue
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// popNames pops n items from the queue, and joins their first letters.
+func popNames(t *testing.T, fq *FairQueue[string], n int) string {
+	var names []string
+	for i := 0; i < n; i++ {
+		item, err := fq.Pop(0)
+		assert.Nil(t, err)
+		names = append(names, item[:1])
+	}
+	return strings.Join(names, "")
+}
+
+func TestFairQueueWeightedRoundRobin(t *testing.T) {
+	fq := NewFairQueue[string](WeightedRoundRobin)
+	assert.True(t, fq.AddQueue("a", NewQueue[string](), 3))
+	assert.True(t, fq.AddQueue("b", NewQueue[string](), 1))
+	assert.False(t, fq.AddQueue("a", NewQueue[string](), 1))
+	assert.Equal(t, ErrNoQueue, fq.Push("c", "c"))
+
+	for i := 0; i < 10; i++ {
+		fq.Push("a", "a")
+		fq.Push("b", "b")
+	}
+	assert.Equal(t, 20, fq.Len())
+	assert.Equal(t, "aaabaaab", popNames(t, fq, 8))
+
+	// the new weight applies from the next turn on
+	assert.True(t, fq.SetWeight("b", 2))
+	assert.False(t, fq.SetWeight("c", 2))
+
+	// once a is drained, b gets all the turns
+	assert.Equal(t, "aaabbabbbbbb", popNames(t, fq, 12))
+	_, err := fq.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+	assert.True(t, fq.Empty())
+}
+
+func TestFairQueueDeficitRoundRobin(t *testing.T) {
+	fq := NewFairQueue[string](DeficitRoundRobin, func(item string) int {
+		return len(item)
+	})
+	fq.AddQueue("big", NewQueue[string](), 4)
+	fq.AddQueue("small", NewQueue[string](), 4)
+
+	for i := 0; i < 10; i++ {
+		fq.Push("big", "bbb")
+		fq.Push("small", "s")
+	}
+	// big carries over its unused credit, so it gets 4 items per 3 turns,
+	// while small gets 4 items per turn
+	assert.Equal(t, "bssssbssssbbss", popNames(t, fq, 14))
+}
+
+func TestFairQueueDeficitRoundRobinFreeItems(t *testing.T) {
+	fq := NewFairQueue[string](DeficitRoundRobin, func(item string) int {
+		if item == "free" {
+			return 0
+		}
+		return -1
+	})
+	fq.AddQueue("free", NewQueue[string](), 2)
+	fq.AddQueue("other", NewQueue[string](), 2)
+
+	for i := 0; i < 4; i++ {
+		fq.Push("free", "free")
+		fq.Push("other", "o")
+	}
+	// items of no cost still take their turn
+	assert.Equal(t, "ffooffoo", popNames(t, fq, 8))
+}
+
+func TestFairQueuePriorityQueue(t *testing.T) {
+	fq := NewFairQueue[int](WeightedRoundRobin)
+	fq.AddQueue("high", NewPriorityQueue(func(a, b int) bool { return a > b }), 1)
+	fq.AddQueue("fifo", NewQueue[int](), 1)
+
+	for _, i := range []int{1, 3, 2} {
+		fq.Push("high", i)
+		fq.Push("fifo", i)
+	}
+	var vals []int
+	for !fq.Empty() {
+		val, err := fq.Pop()
+		assert.Nil(t, err)
+		vals = append(vals, val)
+	}
+	assert.Equal(t, []int{3, 1, 2, 3, 1, 2}, vals)
+}
+
+func TestFairQueueRemoveQueue(t *testing.T) {
+	fq := NewFairQueue[string](WeightedRoundRobin)
+	fq.AddQueue("a", NewQueue[string](), 2)
+	fq.AddQueue("b", NewQueue[string](), 2)
+	fq.AddQueue("c", NewQueue[string](), 2)
+	for i := 0; i < 4; i++ {
+		fq.Push("a", "a")
+		fq.Push("b", "b")
+		fq.Push("c", "c")
+	}
+	assert.Equal(t, "aab", popNames(t, fq, 3))
+
+	q, ok := fq.RemoveQueue("b")
+	assert.True(t, ok)
+	assert.Equal(t, 3, q.Len())
+	_, ok = fq.RemoveQueue("b")
+	assert.False(t, ok)
+	assert.Equal(t, ErrNoQueue, fq.Push("b", "b"))
+
+	assert.Equal(t, 6, fq.Len())
+	assert.Equal(t, "ccaacc", popNames(t, fq, 6))
+}
+
+func TestFairQueueBlocking(t *testing.T) {
+	fq := NewFairQueue[int](WeightedRoundRobin)
+	fq.AddQueue("a", NewQueue[int](), 1)
+
+	_, err := fq.Pop(time.Millisecond)
+	assert.Equal(t, ErrTimeout, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = fq.PopContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		fq.Push("a", 1)
+	}()
+	val, err := fq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+
+	// a sub-queue added with items wakes up blocked pops too
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		q := NewQueue[int]()
+		q.Push(2)
+		fq.AddQueue("b", q, 1)
+	}()
+	val, err = fq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+
+	fq.Push("a", 3)
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		fq.Close()
+	}()
+	val, err = fq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+	_, err = fq.Pop()
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, ErrClosed, fq.Push("a", 4))
+}
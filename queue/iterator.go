@@ -0,0 +1,32 @@
+package queue
+
+import (
+	"github.com/ridewindx/crumb/functional"
+)
+
+// snapshotIterator is a functional.Iterator over a copy of the items of a
+// queue, so that it is unaffected by later changes to the queue.
+type snapshotIterator[T any] struct {
+	items []T
+	next  int
+}
+
+var _ functional.Iterator = (*snapshotIterator[int])(nil)
+
+func newSnapshotIterator[T any](items []T) *snapshotIterator[T] {
+	return &snapshotIterator[T]{items: items}
+}
+
+func (it *snapshotIterator[T]) HasNext() bool {
+	return it.next < len(it.items)
+}
+
+// Next returns the next item, or ErrEmpty once all of them are returned.
+func (it *snapshotIterator[T]) Next() (interface{}, error) {
+	if it.next == len(it.items) {
+		return nil, ErrEmpty
+	}
+	item := it.items[it.next]
+	it.next++
+	return item, nil
+}
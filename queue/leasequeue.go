@@ -0,0 +1,315 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLeaseExpired is returned when acking, nacking or extending a lease
+// that is no longer held, because it expired or was already acked or nacked.
+var ErrLeaseExpired = errors.New("lease expired")
+
+const defaultVisibilityTimeout = 30 * time.Second
+
+// LeaseQueueOptions configures a LeaseQueue.
+type LeaseQueueOptions[T any] struct {
+	// VisibilityTimeout is how long a popped item stays leased before it is
+	// delivered again, unless it is acked. It defaults to 30 seconds.
+	VisibilityTimeout time.Duration
+	// MaxDeliveries is how many times an item is delivered before it is
+	// moved to DeadLetter, instead of being delivered again. Zero means no limit.
+	MaxDeliveries int
+	// DeadLetter receives the items that were delivered MaxDeliveries times
+	// without being acked. It is pushed to with a zero timeout, and the items
+	// it rejects, or all of them if it is nil, are dropped.
+	DeadLetter Interface[T]
+}
+
+// LeaseQueue is an unbounded FIFO queue with at-least-once delivery: Pop
+// leases an item, which is delivered again once the lease expires, unless
+// the consumer acks it first. It is safe for concurrent use, with the
+// blocking Pop of ChannelQueue and RingQueue.
+type LeaseQueue[T any] struct {
+	mutex    sync.Mutex
+	options  LeaseQueueOptions[T]
+	ready    *Queue[leased[T]]
+	leases   *PriorityQueue[*Lease[T]] // the held leases, by deadline
+	notEmpty chan struct{}             // closed when an item becomes ready, if anyone waits
+	dead     []T                       // items to push to the dead-letter queue once unlocked
+	done     chan struct{}
+	closer   sync.Once
+}
+
+// leased is an item waiting for its next delivery.
+type leased[T any] struct {
+	item       T
+	deliveries int
+}
+
+// Lease is a delivery of an item by LeaseQueue.Pop, to be acked or nacked.
+type Lease[T any] struct {
+	Item T
+	// Deliveries is the number of times the item was delivered, counting
+	// this one.
+	Deliveries int
+	deadline   time.Time        // guarded by the lock of the queue
+	handle     *Item[*Lease[T]] // in the leases of the queue
+	queue      *LeaseQueue[T]
+}
+
+// Deadline returns when the lease expires.
+func (l *Lease[T]) Deadline() time.Time {
+	l.queue.mutex.Lock()
+	defer l.queue.mutex.Unlock()
+	return l.deadline
+}
+
+// NewLeaseQueue will allocate a LeaseQueue with the options.
+func NewLeaseQueue[T any](options ...LeaseQueueOptions[T]) *LeaseQueue[T] {
+	lq := &LeaseQueue[T]{
+		ready: NewQueue[leased[T]](),
+		leases: NewPriorityQueue(func(a, b *Lease[T]) bool {
+			return a.deadline.Before(b.deadline)
+		}),
+		done: make(chan struct{}),
+	}
+	if len(options) > 0 {
+		lq.options = options[0]
+	}
+	if lq.options.VisibilityTimeout <= 0 {
+		lq.options.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	return lq
+}
+
+// Push adds the item to the back of the queue. It never blocks. If the
+// queue is closed, return ErrClosed.
+func (lq *LeaseQueue[T]) Push(item T) error {
+	lq.mutex.Lock()
+	defer lq.mutex.Unlock()
+
+	if lq.IsClosed() {
+		return ErrClosed
+	}
+	lq.ready.Push(leased[T]{item: item})
+	broadcast(&lq.notEmpty)
+	return nil
+}
+
+// Pop will lease the item at the front of the queue, for the visibility
+// timeout. If no item is ready, block until one is pushed or its lease
+// expires. If a nonzero timeout is specified, block no more than the timeout
+// duration and return ErrTimeout. If timeout is zero, immediately return
+// ErrEmpty. Once the queue is closed, the remaining items, including those
+// whose leases expire, are still delivered, after which ErrClosed is returned.
+func (lq *LeaseQueue[T]) Pop(timeout ...time.Duration) (*Lease[T], error) {
+	return lq.pop(context.Background(), timeout...)
+}
+
+// PopContext will lease the item at the front of the queue, for the
+// visibility timeout. If no item is ready, block until one is pushed or its
+// lease expires, or until ctx is done, in which case ctx.Err() is returned.
+// Once the queue is closed, the remaining items, including those whose
+// leases expire, are still delivered, after which ErrClosed is returned.
+func (lq *LeaseQueue[T]) PopContext(ctx context.Context) (*Lease[T], error) {
+	return lq.pop(ctx)
+}
+
+func (lq *LeaseQueue[T]) pop(ctx context.Context, timeout ...time.Duration) (*Lease[T], error) {
+	var deadline time.Time
+	if len(timeout) > 0 && timeout[0] > 0 {
+		deadline = time.Now().Add(timeout[0])
+	}
+
+	lq.mutex.Lock()
+	for {
+		now := time.Now()
+		lq.expire(now)
+		if next, err := lq.ready.Pop(); err == nil {
+			lease := &Lease[T]{
+				Item:       next.item,
+				Deliveries: next.deliveries + 1,
+				deadline:   now.Add(lq.options.VisibilityTimeout),
+				queue:      lq,
+			}
+			lease.handle = lq.leases.PushItem(lease)
+			lq.unlock()
+			return lease, nil
+		}
+		if lq.IsClosed() && lq.leases.Empty() {
+			lq.unlock()
+			return nil, ErrClosed
+		}
+		if len(timeout) > 0 && timeout[0] <= 0 {
+			lq.unlock()
+			return nil, ErrEmpty
+		}
+
+		var wait time.Duration // until the earliest lease expires, or forever if 0
+		if earliest, err := lq.leases.Peek(); err == nil {
+			wait = earliest.deadline.Sub(now)
+		}
+		if !deadline.IsZero() {
+			remaining := deadline.Sub(now)
+			if remaining <= 0 {
+				lq.unlock()
+				return nil, ErrTimeout
+			}
+			if wait == 0 || remaining < wait {
+				wait = remaining
+			}
+		}
+
+		notEmpty := waitFor(&lq.notEmpty)
+		lq.unlock()
+		if err := lq.wait(ctx, notEmpty, wait); err != nil {
+			return nil, err
+		}
+		lq.mutex.Lock()
+	}
+}
+
+// wait blocks until ready is closed, ctx is done or, if d is positive,
+// d has elapsed. A nil error means the pop should retry.
+func (lq *LeaseQueue[T]) wait(ctx context.Context, ready <-chan struct{}, d time.Duration) error {
+	var timeout <-chan time.Time
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ready:
+	case <-timeout:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// expire makes the items whose leases expired by now ready again.
+// It must be called with the lock held.
+func (lq *LeaseQueue[T]) expire(now time.Time) {
+	for {
+		earliest, err := lq.leases.Peek()
+		if err != nil || earliest.deadline.After(now) {
+			return
+		}
+		lq.leases.Pop()
+		lq.release(earliest)
+	}
+}
+
+// release makes the item of the lease, which must have left the leases,
+// ready again, or moves it to the dead-letter queue on unlock if it was
+// delivered too many times. It must be called with the lock held.
+func (lq *LeaseQueue[T]) release(lease *Lease[T]) {
+	if limit := lq.options.MaxDeliveries; limit > 0 && lease.Deliveries >= limit {
+		if lq.options.DeadLetter != nil {
+			lq.dead = append(lq.dead, lease.Item)
+		}
+		return
+	}
+	lq.ready.Push(leased[T]{item: lease.Item, deliveries: lease.Deliveries})
+	broadcast(&lq.notEmpty)
+}
+
+// unlock releases the lock, then pushes the items released by expire or
+// Nack to the dead-letter queue, which is thus free to call back into the
+// queue, or to take its time.
+func (lq *LeaseQueue[T]) unlock() {
+	dead := lq.dead
+	lq.dead = nil
+	lq.mutex.Unlock()
+	for _, item := range dead {
+		lq.options.DeadLetter.Push(item, 0)
+	}
+}
+
+// Ack removes the item of the lease from the queue for good. If the lease
+// is no longer held, return ErrLeaseExpired, as the item may be delivered
+// again.
+func (lq *LeaseQueue[T]) Ack(lease *Lease[T]) error {
+	lq.mutex.Lock()
+	defer lq.unlock()
+
+	lq.expire(time.Now())
+	if !lq.leases.Remove(lease.handle) {
+		return ErrLeaseExpired
+	}
+	if lq.IsClosed() && lq.leases.Empty() {
+		// wake up the pops waiting for the leases, to return ErrClosed
+		broadcast(&lq.notEmpty)
+	}
+	return nil
+}
+
+// Nack gives up the lease, so that the item is delivered again right away,
+// at the back of the queue, or is moved to the dead-letter queue. If the
+// lease is no longer held, return ErrLeaseExpired.
+func (lq *LeaseQueue[T]) Nack(lease *Lease[T]) error {
+	lq.mutex.Lock()
+	defer lq.unlock()
+
+	lq.expire(time.Now())
+	if !lq.leases.Remove(lease.handle) {
+		return ErrLeaseExpired
+	}
+	lq.release(lease)
+	return nil
+}
+
+// Extend pushes the deadline of the lease to d from now, e.g. to keep
+// an item that takes long to process from being delivered again. If the
+// lease is no longer held, return ErrLeaseExpired.
+func (lq *LeaseQueue[T]) Extend(lease *Lease[T], d time.Duration) error {
+	lq.mutex.Lock()
+	defer lq.unlock()
+
+	now := time.Now()
+	lq.expire(now)
+	if !lq.leases.Contains(lease.handle) {
+		return ErrLeaseExpired
+	}
+	lease.deadline = now.Add(d)
+	lq.leases.Update(lease.handle)
+	return nil
+}
+
+// Close closes the queue and wakes up all blocked consumers. Further pushes
+// return ErrClosed, while pops keep delivering the remaining items until
+// the queue is drained and no lease is held. Close is idempotent.
+func (lq *LeaseQueue[T]) Close() {
+	lq.closer.Do(func() {
+		close(lq.done)
+		lq.mutex.Lock()
+		broadcast(&lq.notEmpty)
+		lq.mutex.Unlock()
+	})
+}
+
+// IsClosed reports whether the queue has been closed.
+func (lq *LeaseQueue[T]) IsClosed() bool {
+	return isDone(lq.done)
+}
+
+// Len returns the number of items in the queue, whether leased or not.
+func (lq *LeaseQueue[T]) Len() int {
+	lq.mutex.Lock()
+	defer lq.mutex.Unlock()
+	return lq.ready.Len() + lq.leases.Len()
+}
+
+// InFlight returns the number of items that are leased.
+func (lq *LeaseQueue[T]) InFlight() int {
+	lq.mutex.Lock()
+	defer lq.mutex.Unlock()
+	return lq.leases.Len()
+}
+
+// Empty returns whether the queue is empty.
+func (lq *LeaseQueue[T]) Empty() bool {
+	return lq.Len() == 0
+}
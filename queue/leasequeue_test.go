@@ -0,0 +1,178 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaseQueueAck(t *testing.T) {
+	lq := NewLeaseQueue[int]()
+	lq.Push(1)
+	lq.Push(2)
+
+	lease, err := lq.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, lease.Item)
+	assert.Equal(t, 1, lease.Deliveries)
+	assert.True(t, lease.Deadline().After(time.Now().Add(29*time.Second)))
+	assert.Equal(t, 2, lq.Len())
+	assert.Equal(t, 1, lq.InFlight())
+
+	assert.Nil(t, lq.Ack(lease))
+	assert.Equal(t, ErrLeaseExpired, lq.Ack(lease))
+	assert.Equal(t, ErrLeaseExpired, lq.Nack(lease))
+	assert.Equal(t, 1, lq.Len())
+
+	// a nacked item is delivered again right away
+	lease, _ = lq.Pop(0)
+	assert.Equal(t, 2, lease.Item)
+	assert.Nil(t, lq.Nack(lease))
+	lease, _ = lq.Pop(0)
+	assert.Equal(t, 2, lease.Item)
+	assert.Equal(t, 2, lease.Deliveries)
+	assert.Nil(t, lq.Ack(lease))
+
+	_, err = lq.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+	assert.True(t, lq.Empty())
+}
+
+func TestLeaseQueueVisibilityTimeout(t *testing.T) {
+	lq := NewLeaseQueue(LeaseQueueOptions[int]{VisibilityTimeout: 20 * time.Millisecond})
+	lq.Push(1)
+
+	lease, err := lq.Pop(0)
+	assert.Nil(t, err)
+	_, err = lq.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+
+	// a blocked pop gets the item once its lease expires
+	again, err := lq.Pop(time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, again.Item)
+	assert.Equal(t, 2, again.Deliveries)
+	assert.Equal(t, ErrLeaseExpired, lq.Ack(lease))
+
+	// an extended lease outlives the visibility timeout
+	assert.Nil(t, lq.Extend(again, time.Second))
+	_, err = lq.Pop(10 * time.Millisecond)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Nil(t, lq.Ack(again))
+	assert.Equal(t, ErrLeaseExpired, lq.Extend(again, time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = lq.PopContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestLeaseQueueDeadLetter(t *testing.T) {
+	deadLetter := NewQueue[string]()
+	lq := NewLeaseQueue(LeaseQueueOptions[string]{
+		VisibilityTimeout: 5 * time.Millisecond,
+		MaxDeliveries:     3,
+		DeadLetter:        deadLetter,
+	})
+	lq.Push("poison")
+
+	for i := 1; i <= 3; i++ {
+		lease, err := lq.Pop(time.Second)
+		assert.Nil(t, err)
+		assert.Equal(t, "poison", lease.Item)
+		assert.Equal(t, i, lease.Deliveries)
+		if i < 3 {
+			lq.Nack(lease)
+		}
+		// the last lease expires instead
+	}
+	lq.Push("ok")
+	lease, err := lq.Pop(time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", lease.Item)
+	assert.Nil(t, lq.Ack(lease))
+
+	time.Sleep(10 * time.Millisecond)
+	_, err = lq.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+	assert.True(t, lq.Empty())
+	assert.Equal(t, 1, deadLetter.Len())
+	item, _ := deadLetter.Pop()
+	assert.Equal(t, "poison", item)
+}
+
+// reentrantQueue is a Queue whose Push calls a function first, for tests.
+type reentrantQueue[T any] struct {
+	*Queue[T]
+	onPush func()
+}
+
+func (q *reentrantQueue[T]) Push(item T, timeout ...time.Duration) error {
+	q.onPush()
+	return q.Queue.Push(item, timeout...)
+}
+
+func TestLeaseQueueDeadLetterUnlocked(t *testing.T) {
+	var lq *LeaseQueue[int]
+	deadLetter := &reentrantQueue[int]{Queue: NewQueue[int]()}
+	lq = NewLeaseQueue(LeaseQueueOptions[int]{
+		MaxDeliveries: 1,
+		DeadLetter:    deadLetter,
+	})
+	// the dead-letter queue is pushed to once the queue is unlocked
+	deadLetter.onPush = func() {
+		assert.Equal(t, 0, lq.Len())
+	}
+	lq.Push(1)
+
+	lease, err := lq.Pop(0)
+	assert.Nil(t, err)
+	assert.Nil(t, lq.Nack(lease))
+	assert.Equal(t, 1, deadLetter.Len())
+}
+
+func TestLeaseQueueExtendConcurrent(t *testing.T) {
+	lq := NewLeaseQueue[int]()
+	lq.Push(1)
+	lease, _ := lq.Pop(0)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			lq.Extend(lease, time.Minute)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.True(t, lease.Deadline().After(time.Now()))
+	}
+	<-done
+}
+
+func TestLeaseQueueClose(t *testing.T) {
+	lq := NewLeaseQueue[int]()
+	lq.Push(1)
+	lease, _ := lq.Pop()
+
+	lq.Close()
+	assert.True(t, lq.IsClosed())
+	assert.Equal(t, ErrClosed, lq.Push(2))
+
+	// pops wait for the held leases, which may be nacked
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		lq.Nack(lease)
+	}()
+	lease, err := lq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, lease.Item)
+
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		lq.Ack(lease)
+	}()
+	_, err = lq.Pop()
+	assert.Equal(t, ErrClosed, err)
+}
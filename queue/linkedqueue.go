@@ -0,0 +1,152 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LinkedQueue is an unbounded MPMC linked list queue that achieves
+// concurrency with CAS operations only, after Michael and Scott.
+type LinkedQueue[T any] struct {
+	padding0 [8]uint64
+	head     atomic.Pointer[linknode[T]] // dummy node before the front item
+	padding1 [8]uint64
+	tail     atomic.Pointer[linknode[T]]
+	padding2 [8]uint64
+	length   atomic.Int64
+	padding3 [8]uint64
+	strategy WaitStrategy
+	signal   bool
+	notEmpty chan struct{}
+	done     chan struct{}
+	closer   sync.Once
+}
+
+type linknode[T any] struct {
+	next atomic.Pointer[linknode[T]]
+	data T
+}
+
+// NewLinkedQueue will allocate a LinkedQueue. The `strategy` specifies how
+// a pop waits while the queue is empty, as for NewRingQueue.
+func NewLinkedQueue[T any](strategy WaitStrategy) *LinkedQueue[T] {
+	lq := &LinkedQueue[T]{
+		strategy: strategy,
+		signal:   strategy.Parks(),
+		notEmpty: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	dummy := &linknode[T]{}
+	lq.head.Store(dummy)
+	lq.tail.Store(dummy)
+	return lq
+}
+
+// Push adds the item to the queue. As the queue is unbounded, it never
+// blocks and the timeout is ignored. If the queue is closed, return ErrClosed.
+func (lq *LinkedQueue[T]) Push(item T, timeout ...time.Duration) error {
+	if lq.IsClosed() {
+		return ErrClosed
+	}
+	n := &linknode[T]{data: item}
+	for {
+		tail := lq.tail.Load()
+		next := tail.next.Load()
+		if tail != lq.tail.Load() { // another push occurred
+			continue
+		}
+		if next == nil {
+			if tail.next.CompareAndSwap(nil, n) {
+				lq.tail.CompareAndSwap(tail, n)
+				break
+			}
+		} else { // help the other push to swing the tail
+			lq.tail.CompareAndSwap(tail, next)
+		}
+	}
+	lq.length.Add(1)
+	if lq.signal {
+		notify(lq.notEmpty)
+	}
+	return nil
+}
+
+// Pop will return the next item in the queue. If the queue is empty,
+// block until an item can be returned. If a nonzero timeout is specified,
+// block no more than the timeout duration and return ErrTimeout. If timeout
+// is zero, immediately return ErrEmpty. Once the queue is closed, the
+// remaining items are still returned, after which ErrClosed is returned.
+func (lq *LinkedQueue[T]) Pop(timeout ...time.Duration) (T, error) {
+	return lq.pop(context.Background(), timeout...)
+}
+
+// PopContext will return the next item in the queue. If the queue is empty,
+// block until an item can be returned or ctx is done, in which case
+// ctx.Err() is returned. Once the queue is closed, the remaining items
+// are still returned, after which ErrClosed is returned.
+func (lq *LinkedQueue[T]) PopContext(ctx context.Context) (T, error) {
+	return lq.pop(ctx)
+}
+
+func (lq *LinkedQueue[T]) pop(ctx context.Context, timeout ...time.Duration) (T, error) {
+	var zero T
+	w := newWaiter(ctx, timeout)
+	for {
+		head := lq.head.Load()
+		tail := lq.tail.Load()
+		next := head.next.Load()
+		if head != lq.head.Load() { // another pop occurred
+			continue
+		}
+		if next == nil { // queue is empty
+			if lq.IsClosed() {
+				return zero, ErrClosed
+			}
+			if err := w.wait(lq.strategy, lq.notEmpty, lq.done, ErrEmpty); err != nil {
+				return zero, err
+			}
+		} else if head == tail { // help a push to swing the tail
+			lq.tail.CompareAndSwap(tail, next)
+		} else if lq.head.CompareAndSwap(head, next) {
+			// next is the new dummy node, and only the pop that
+			// unlinked head may take its data
+			data := next.data
+			next.data = zero
+			lq.length.Add(-1)
+			if lq.signal && w.attempt > 0 && !lq.Empty() {
+				notify(lq.notEmpty) // pass the wakeup on to the next blocked pop
+			}
+			return data, nil
+		}
+	}
+}
+
+// Close closes the queue and wakes up all blocked consumers.
+// Further pushes return ErrClosed, while pops keep returning the remaining
+// items until the queue is drained. Close is idempotent.
+func (lq *LinkedQueue[T]) Close() {
+	lq.closer.Do(func() {
+		close(lq.done)
+	})
+}
+
+// IsClosed reports whether the queue has been closed.
+func (lq *LinkedQueue[T]) IsClosed() bool {
+	return isDone(lq.done)
+}
+
+// Len returns the number of items in the queue. Under concurrent pushes
+// and pops it may lag behind for an instant.
+func (lq *LinkedQueue[T]) Len() int {
+	if n := lq.length.Load(); n > 0 {
+		return int(n)
+	}
+	return 0
+}
+
+// Empty returns whether the queue is empty.
+func (lq *LinkedQueue[T]) Empty() bool {
+	return lq.head.Load().next.Load() == nil
+}
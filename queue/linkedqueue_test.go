@@ -0,0 +1,238 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkedQueuePushPop(t *testing.T) {
+	lq := NewLinkedQueue[int](BlockingWait{})
+
+	assert.True(t, lq.Empty())
+	assert.Zero(t, lq.Len())
+
+	err := lq.Push(1)
+	assert.Nil(t, err)
+
+	assert.False(t, lq.Empty())
+	assert.Equal(t, 1, lq.Len())
+
+	val, err := lq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+
+	for i := 2; i <= 100; i++ {
+		lq.Push(i)
+	}
+	assert.Equal(t, 99, lq.Len())
+	for i := 2; i <= 100; i++ {
+		val, err = lq.Pop(0)
+		assert.Nil(t, err)
+		assert.Equal(t, i, val)
+	}
+	assert.True(t, lq.Empty())
+}
+
+func TestLinkedQueueSpinTimeout(t *testing.T) {
+	testLinkedQueueTimeout(t, BusySpinWait{})
+}
+
+func TestLinkedQueueChannelTimeout(t *testing.T) {
+	testLinkedQueueTimeout(t, BlockingWait{})
+}
+
+func testLinkedQueueTimeout(t *testing.T, wait WaitStrategy) {
+	lq := NewLinkedQueue[int](wait)
+
+	val, err := lq.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+	assert.Zero(t, val)
+	val, err = lq.Pop(time.Millisecond)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Zero(t, val)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	val, err = lq.PopContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Zero(t, val)
+
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		err := lq.Push(1)
+		assert.Nil(t, err)
+	}()
+	val, err = lq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+}
+
+func TestLinkedQueueSpinClose(t *testing.T) {
+	testLinkedQueueClose(t, BusySpinWait{})
+}
+
+func TestLinkedQueueChannelClose(t *testing.T) {
+	testLinkedQueueClose(t, BlockingWait{})
+}
+
+func testLinkedQueueClose(t *testing.T, wait WaitStrategy) {
+	lq := NewLinkedQueue[int](wait)
+	assert.False(t, lq.IsClosed())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		val, err := lq.Pop()
+		assert.Equal(t, ErrClosed, err)
+		assert.Zero(t, val)
+	}()
+	time.Sleep(2 * time.Millisecond)
+	lq.Close()
+	wg.Wait()
+	assert.True(t, lq.IsClosed())
+
+	lq = NewLinkedQueue[int](wait)
+	lq.Push(1)
+	lq.Close()
+	lq.Close()
+
+	assert.Equal(t, ErrClosed, lq.Push(2))
+	val, err := lq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	val, err = lq.Pop()
+	assert.Equal(t, ErrClosed, err)
+	assert.Zero(t, val)
+}
+
+func TestLinkedQueueWaitStrategies(t *testing.T) {
+	for name, wait := range waitStrategies {
+		t.Run(name, func(t *testing.T) {
+			testLinkedQueueTimeout(t, wait)
+			testLinkedQueueClose(t, wait)
+			testLinkedQueueConcurrent(t, wait)
+		})
+	}
+}
+
+func testLinkedQueueConcurrent(t *testing.T, wait WaitStrategy) {
+	const producers, items = 4, 1000
+	lq := NewLinkedQueue[int](wait)
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < items; i++ {
+				assert.Nil(t, lq.Push(p*items+i))
+			}
+		}(p)
+	}
+
+	seen := make([]bool, producers*items)
+	var mu sync.Mutex
+	var cwg sync.WaitGroup
+	for c := 0; c < producers; c++ {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			last := make([]int, producers) // per producer, items must be in order
+			for p := range last {
+				last[p] = -1
+			}
+			for {
+				val, err := lq.Pop()
+				if err == ErrClosed {
+					return
+				}
+				assert.Nil(t, err)
+				assert.True(t, val%items > last[val/items])
+				last[val/items] = val % items
+				mu.Lock()
+				assert.False(t, seen[val])
+				seen[val] = true
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	lq.Close()
+	cwg.Wait()
+	for _, ok := range seen {
+		assert.True(t, ok)
+	}
+	assert.True(t, lq.Empty())
+	assert.Zero(t, lq.Len())
+}
+
+func BenchmarkLinkedQueueSpinPushPop(b *testing.B) {
+	lq := NewLinkedQueue[int](BusySpinWait{})
+
+	var count int
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		for {
+			_, err := lq.Pop()
+			assert.Nil(b, err)
+
+			count++
+			if count == b.N {
+				return
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lq.Push(i)
+	}
+
+	wg.Wait()
+}
+
+func BenchmarkLinkedQueuePush(b *testing.B) {
+	lq := NewLinkedQueue[int](BusySpinWait{})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lq.Push(i)
+	}
+}
+
+func BenchmarkLinkedQueuePop(b *testing.B) {
+	lq := NewLinkedQueue[int](BusySpinWait{})
+
+	for i := 0; i < b.N; i++ {
+		err := lq.Push(i)
+		assert.Nil(b, err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lq.Pop()
+	}
+}
+
+func BenchmarkLinkedQueueParallelPushPop(b *testing.B) {
+	lq := NewLinkedQueue[int](BusySpinWait{})
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			lq.Push(i)
+			lq.Pop()
+			i++
+		}
+	})
+}
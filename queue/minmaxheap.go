@@ -0,0 +1,216 @@
+package queue
+
+import (
+	"math/bits"
+	"time"
+)
+
+// MinMaxHeap is an unbounded double-ended priority queue, which pops items
+// from both ends: the highest priority, like PriorityQueue, and the lowest,
+// e.g. to drop the least important job when saturated. Peeks take O(1),
+// pushes and pops O(log n). It is not safe for concurrent use.
+type MinMaxHeap[T any] struct {
+	minmaxheap[T]
+}
+
+// NewMinMaxHeap will allocate a MinMaxHeap.
+// Function comparePriority reports whether the element a has higher priority than the element b.
+func NewMinMaxHeap[T any](comparePriority func(a, b T) bool, sizeHint ...int) *MinMaxHeap[T] {
+	h := &MinMaxHeap[T]{
+		minmaxheap: minmaxheap[T]{comparePriority: comparePriority},
+	}
+	if len(sizeHint) > 0 {
+		h.items = make([]T, 0, sizeHint[0])
+	}
+	return h
+}
+
+// Push adds the item to the heap. It never fails.
+func (h *MinMaxHeap[T]) Push(item T, timeout ...time.Duration) error {
+	h.push(item)
+	return nil
+}
+
+// Pop is PopMax, so that the heap pops in priority order like PriorityQueue.
+func (h *MinMaxHeap[T]) Pop(timeout ...time.Duration) (T, error) {
+	return h.PopMax()
+}
+
+// PopMax removes and returns the item with the highest priority,
+// or returns ErrEmpty if the heap is empty.
+func (h *MinMaxHeap[T]) PopMax() (T, error) {
+	if len(h.items) == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return h.removeAt(0), nil
+}
+
+// PopMin removes and returns the item with the lowest priority,
+// or returns ErrEmpty if the heap is empty.
+func (h *MinMaxHeap[T]) PopMin() (T, error) {
+	if len(h.items) == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return h.removeAt(h.minIndex()), nil
+}
+
+// PeekMax returns the item with the highest priority without removing it,
+// or returns ErrEmpty if the heap is empty.
+func (h *MinMaxHeap[T]) PeekMax() (T, error) {
+	if len(h.items) == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return h.items[0], nil
+}
+
+// PeekMin returns the item with the lowest priority without removing it,
+// or returns ErrEmpty if the heap is empty.
+func (h *MinMaxHeap[T]) PeekMin() (T, error) {
+	if len(h.items) == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return h.items[h.minIndex()], nil
+}
+
+// Len returns the number of items in the heap.
+func (h *MinMaxHeap[T]) Len() int {
+	return len(h.items)
+}
+
+// Empty returns whether the heap is empty.
+func (h *MinMaxHeap[T]) Empty() bool {
+	return len(h.items) == 0
+}
+
+// minmaxheap is a min-max heap, after Atkinson et al.: a binary heap whose
+// even levels are ordered by the highest priority and odd levels by the
+// lowest, so that both ends are found in O(1) and removed in O(log n).
+type minmaxheap[T any] struct {
+	items           []T
+	comparePriority func(a, b T) bool
+}
+
+func (h *minmaxheap[T]) higher(a, b T) bool {
+	return h.comparePriority(a, b)
+}
+
+func (h *minmaxheap[T]) lower(a, b T) bool {
+	return h.comparePriority(b, a)
+}
+
+// maxLevel reports whether the node i is on a level ordered by the highest priority.
+func maxLevel(i int) bool {
+	return bits.Len(uint(i+1))%2 == 1
+}
+
+func (h *minmaxheap[T]) push(item T) {
+	h.items = append(h.items, item)
+	h.bubbleUp(len(h.items) - 1)
+}
+
+// minIndex returns the index of the item with the lowest priority, which
+// is the root or one of its children.
+func (h *minmaxheap[T]) minIndex() int {
+	switch len(h.items) {
+	case 1:
+		return 0
+	case 2:
+		return 1
+	}
+	if h.lower(h.items[2], h.items[1]) {
+		return 2
+	}
+	return 1
+}
+
+// removeAt removes and returns the item at the index i, which must be the
+// max or min index.
+func (h *minmaxheap[T]) removeAt(i int) T {
+	var zero T
+	n := len(h.items) - 1
+	item := h.items[i]
+	h.items[i] = h.items[n]
+	h.items[n] = zero
+	h.items = h.items[:n]
+	if i < n {
+		h.trickleDown(i)
+	}
+	return item
+}
+
+func (h *minmaxheap[T]) swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+func (h *minmaxheap[T]) bubbleUp(i int) {
+	if i == 0 {
+		return
+	}
+	parent := (i - 1) / 2
+	if maxLevel(i) {
+		if h.lower(h.items[i], h.items[parent]) {
+			h.swap(i, parent)
+			h.bubbleUpBy(parent, h.lower)
+		} else {
+			h.bubbleUpBy(i, h.higher)
+		}
+	} else {
+		if h.higher(h.items[i], h.items[parent]) {
+			h.swap(i, parent)
+			h.bubbleUpBy(parent, h.higher)
+		} else {
+			h.bubbleUpBy(i, h.lower)
+		}
+	}
+}
+
+// bubbleUpBy moves the node i up its grandparents while it is better.
+func (h *minmaxheap[T]) bubbleUpBy(i int, better func(a, b T) bool) {
+	for i > 2 {
+		grandparent := ((i-1)/2 - 1) / 2
+		if !better(h.items[i], h.items[grandparent]) {
+			return
+		}
+		h.swap(i, grandparent)
+		i = grandparent
+	}
+}
+
+func (h *minmaxheap[T]) trickleDown(i int) {
+	if maxLevel(i) {
+		h.trickleDownBy(i, h.higher)
+	} else {
+		h.trickleDownBy(i, h.lower)
+	}
+}
+
+// trickleDownBy moves the node i down while one of its children or
+// grandchildren is better.
+func (h *minmaxheap[T]) trickleDownBy(i int, better func(a, b T) bool) {
+	n := len(h.items)
+	for {
+		// find the best of the children and grandchildren
+		m := -1
+		for _, c := range [...]int{2*i + 1, 2*i + 2, 4*i + 3, 4*i + 4, 4*i + 5, 4*i + 6} {
+			if c < n && (m < 0 || better(h.items[c], h.items[m])) {
+				m = c
+			}
+		}
+		if m < 0 || !better(h.items[m], h.items[i]) {
+			return
+		}
+
+		h.swap(m, i)
+		if m <= 2*i+2 { // a child, which has no children of its level
+			return
+		}
+		if parent := (m - 1) / 2; better(h.items[parent], h.items[m]) {
+			h.swap(m, parent)
+		}
+		i = m
+	}
+}
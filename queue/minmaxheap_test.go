@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinMaxHeap(t *testing.T) {
+	h := NewMinMaxHeap(func(a, b int) bool { return a > b })
+
+	_, err := h.PeekMax()
+	assert.Equal(t, ErrEmpty, err)
+	_, err = h.PeekMin()
+	assert.Equal(t, ErrEmpty, err)
+	_, err = h.PopMin()
+	assert.Equal(t, ErrEmpty, err)
+
+	for _, i := range []int{4, 8, 1, 6, 3} {
+		assert.Nil(t, h.Push(i))
+	}
+	assert.Equal(t, 5, h.Len())
+	val, err := h.PeekMax()
+	assert.Nil(t, err)
+	assert.Equal(t, 8, val)
+	val, err = h.PeekMin()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+
+	val, _ = h.PopMin()
+	assert.Equal(t, 1, val)
+	val, _ = h.PopMax()
+	assert.Equal(t, 8, val)
+	val, _ = h.Pop()
+	assert.Equal(t, 6, val)
+	val, _ = h.PopMin()
+	assert.Equal(t, 3, val)
+	val, _ = h.PopMin()
+	assert.Equal(t, 4, val)
+	assert.True(t, h.Empty())
+}
+
+func TestMinMaxHeapRandom(t *testing.T) {
+	h := NewMinMaxHeap(func(a, b int) bool { return a > b }, 64)
+	var sorted []int // the items in the heap, from the lowest to the highest
+
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 5000; i++ {
+		switch op := r.Intn(4); {
+		case op < 2 || len(sorted) == 0:
+			val := r.Intn(1000)
+			h.Push(val)
+			sorted = append(sorted, val)
+			sort.Ints(sorted)
+		case op == 2:
+			val, err := h.PopMax()
+			assert.Nil(t, err)
+			assert.Equal(t, sorted[len(sorted)-1], val)
+			sorted = sorted[:len(sorted)-1]
+		default:
+			val, err := h.PopMin()
+			assert.Nil(t, err)
+			assert.Equal(t, sorted[0], val)
+			sorted = sorted[1:]
+		}
+		assert.Equal(t, len(sorted), h.Len())
+		if len(sorted) > 0 {
+			val, _ := h.PeekMax()
+			assert.Equal(t, sorted[len(sorted)-1], val)
+			val, _ = h.PeekMin()
+			assert.Equal(t, sorted[0], val)
+		}
+	}
+}
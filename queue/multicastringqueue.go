@@ -0,0 +1,318 @@
+package queue
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MulticastRingQueue is a bounded MPMC ring buffer in the style of the LMAX
+// Disruptor, where every consumer sees every item. Each consumer, created by
+// Subscribe, reads the items at its own pace with its own cursor, while
+// producers wait for the slowest consumer before overwriting an item.
+// Consumers can be chained, so that one only sees an item once the consumers
+// it depends on have seen it.
+type MulticastRingQueue[T any] struct {
+	padding0  [8]uint64
+	next      uint64 // the next sequence to claim by a push
+	padding1  [8]uint64
+	gatingMin uint64 // cache of the minimum cursor of the consumers
+	padding2  [8]uint64
+	mask      uint64
+	slots     []multicastslot[T]
+	consumers atomic.Pointer[[]*MulticastConsumer[T]]
+	mutex     sync.Mutex // serializes changes to consumers
+	strategy  WaitStrategy
+	signal    bool
+	notFull   chan struct{}
+	done      chan struct{}
+	closer    sync.Once
+}
+
+type multicastslot[T any] struct {
+	published uint64 // sequence+1 of the item in the slot, 0 if none yet
+	data      T
+}
+
+// MulticastConsumer reads every item of a MulticastRingQueue in order.
+// A consumer must not be used by more than one goroutine at a time.
+type MulticastConsumer[T any] struct {
+	padding0   [8]uint64
+	cursor     uint64 // the next sequence to read
+	padding1   [8]uint64
+	mq         *MulticastRingQueue[T]
+	deps       []*MulticastConsumer[T]
+	dependents atomic.Pointer[[]*MulticastConsumer[T]]
+	notEmpty   chan struct{}
+}
+
+// NewMulticastRingQueue will allocate a MulticastRingQueue with the specified
+// capacity. The `strategy` specifies how producers and consumers wait when
+// they will be blocked, as for NewRingQueue.
+func NewMulticastRingQueue[T any](capacity int, strategy WaitStrategy) *MulticastRingQueue[T] {
+	if capacity == 0 {
+		panic("MulticastRingQueue capacity must be greater than 0")
+	}
+	n := roundUp(uint64(capacity))
+
+	mq := &MulticastRingQueue[T]{
+		slots:    make([]multicastslot[T], n),
+		mask:     n - 1,
+		strategy: strategy,
+		signal:   strategy.Parks(),
+		notFull:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	mq.consumers.Store(&[]*MulticastConsumer[T]{})
+	return mq
+}
+
+// Subscribe adds a consumer that sees the items pushed from now on. If
+// consumers are specified, the new consumer only sees an item once all of
+// them have seen it. Consumers should subscribe before the first push,
+// unless missing the items pushed until then is fine.
+func (mq *MulticastRingQueue[T]) Subscribe(after ...*MulticastConsumer[T]) *MulticastConsumer[T] {
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+
+	c := &MulticastConsumer[T]{
+		mq:       mq,
+		deps:     after,
+		notEmpty: make(chan struct{}, 1),
+	}
+	c.cursor = atomic.LoadUint64(&mq.next)
+	for _, dep := range after {
+		if cursor := atomic.LoadUint64(&dep.cursor); cursor < c.cursor {
+			c.cursor = cursor
+		}
+		dependents := append(append([]*MulticastConsumer[T]{}, *dep.dependents.Load()...), c)
+		dep.dependents.Store(&dependents)
+	}
+	c.dependents.Store(&[]*MulticastConsumer[T]{})
+
+	consumers := append(append([]*MulticastConsumer[T]{}, *mq.consumers.Load()...), c)
+	mq.consumers.Store(&consumers)
+	atomic.StoreUint64(&mq.gatingMin, mq.minCursor())
+	return c
+}
+
+// Unsubscribe removes the consumer, so that producers no longer wait for it.
+// Consumers that depend on it no longer wait for it either.
+func (c *MulticastConsumer[T]) Unsubscribe() {
+	mq := c.mq
+	mq.mutex.Lock()
+	defer mq.mutex.Unlock()
+
+	consumers := make([]*MulticastConsumer[T], 0, len(*mq.consumers.Load()))
+	for _, other := range *mq.consumers.Load() {
+		if other != c {
+			consumers = append(consumers, other)
+		}
+	}
+	mq.consumers.Store(&consumers)
+	for _, dep := range c.deps {
+		dependents := make([]*MulticastConsumer[T], 0, len(*dep.dependents.Load()))
+		for _, other := range *dep.dependents.Load() {
+			if other != c {
+				dependents = append(dependents, other)
+			}
+		}
+		dep.dependents.Store(&dependents)
+	}
+	atomic.StoreUint64(&c.cursor, math.MaxUint64)
+	for _, dependent := range *c.dependents.Load() {
+		notify(dependent.notEmpty)
+	}
+	notify(mq.notFull)
+}
+
+// Push adds the item to the queue for every consumer. If the queue is full,
+// i.e. the slowest consumer lags behind by the capacity, will block until it
+// catches up. If a nonzero timeout is specified, block no more than the
+// timeout duration and return ErrTimeout. If timeout is zero, immediately
+// return ErrFull. If the queue is closed, return ErrClosed.
+func (mq *MulticastRingQueue[T]) Push(item T, timeout ...time.Duration) error {
+	return mq.push(context.Background(), item, timeout...)
+}
+
+// PushContext adds the item to the queue for every consumer. If the queue is
+// full, will block until the slowest consumer catches up or ctx is done, in
+// which case ctx.Err() is returned. If the queue is closed, return ErrClosed.
+func (mq *MulticastRingQueue[T]) PushContext(ctx context.Context, item T) error {
+	return mq.push(ctx, item)
+}
+
+func (mq *MulticastRingQueue[T]) push(ctx context.Context, item T, timeout ...time.Duration) error {
+	w := newWaiter(ctx, timeout)
+	var seq uint64
+	for {
+		if mq.IsClosed() {
+			return ErrClosed
+		}
+		seq = atomic.LoadUint64(&mq.next)
+		if seq-atomic.LoadUint64(&mq.gatingMin) > mq.mask {
+			gatingMin := mq.minCursor()
+			atomic.StoreUint64(&mq.gatingMin, gatingMin)
+			if seq-gatingMin > mq.mask { // queue is full
+				if err := w.wait(mq.strategy, mq.notFull, mq.done, ErrFull); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if atomic.CompareAndSwapUint64(&mq.next, seq, seq+1) {
+			break
+		}
+		// another push occurred
+	}
+	if mq.signal && w.attempt > 0 {
+		notify(mq.notFull) // pass the wakeup on to the next blocked push
+	}
+
+	slot := &mq.slots[seq&mq.mask]
+	slot.data = item
+	atomic.StoreUint64(&slot.published, seq+1)
+	if mq.signal {
+		for _, c := range *mq.consumers.Load() {
+			if len(c.deps) == 0 {
+				notify(c.notEmpty)
+			}
+		}
+	}
+	return nil
+}
+
+// minCursor returns the sequence of the slowest consumer, or the next
+// sequence to claim if there is no consumer.
+func (mq *MulticastRingQueue[T]) minCursor() uint64 {
+	min := atomic.LoadUint64(&mq.next)
+	for _, c := range *mq.consumers.Load() {
+		if cursor := atomic.LoadUint64(&c.cursor); cursor < min {
+			min = cursor
+		}
+	}
+	return min
+}
+
+// Pop will return the next item for the consumer. If there is none yet,
+// or the consumers it depends on have not seen it yet, block until it can
+// be returned. If a nonzero timeout is specified, block no more than the
+// timeout duration and return ErrTimeout. If timeout is zero, immediately
+// return ErrEmpty. Once the queue is closed, the remaining items are still
+// returned, after which ErrClosed is returned.
+func (c *MulticastConsumer[T]) Pop(timeout ...time.Duration) (T, error) {
+	return c.pop(context.Background(), timeout...)
+}
+
+// PopContext will return the next item for the consumer. If there is none
+// yet, or the consumers it depends on have not seen it yet, block until it
+// can be returned or ctx is done, in which case ctx.Err() is returned. Once
+// the queue is closed, the remaining items are still returned, after which
+// ErrClosed is returned.
+func (c *MulticastConsumer[T]) PopContext(ctx context.Context) (T, error) {
+	return c.pop(ctx)
+}
+
+func (c *MulticastConsumer[T]) pop(ctx context.Context, timeout ...time.Duration) (T, error) {
+	var zero T
+	mq := c.mq
+	w := newWaiter(ctx, timeout)
+	seq := c.cursor
+	slot := &mq.slots[seq&mq.mask]
+	closed := mq.done
+	for !c.available(seq, slot) {
+		if mq.IsClosed() {
+			if c.drained(seq) {
+				return zero, ErrClosed
+			}
+			if closed != nil {
+				// the item is still to come from a push in flight or from
+				// the consumers c depends on, which notify c, so stop
+				// waking up on the close
+				closed, w.cond = nil, nil
+			}
+		}
+		if err := w.wait(mq.strategy, c.notEmpty, closed, ErrEmpty); err != nil {
+			return zero, err
+		}
+	}
+
+	item := slot.data
+	atomic.StoreUint64(&c.cursor, seq+1)
+	if mq.signal {
+		notify(mq.notFull)
+		for _, dependent := range *c.dependents.Load() {
+			notify(dependent.notEmpty)
+		}
+	}
+	return item, nil
+}
+
+// available reports whether the item of sequence seq is published in slot,
+// and seen by all the consumers c depends on.
+func (c *MulticastConsumer[T]) available(seq uint64, slot *multicastslot[T]) bool {
+	if atomic.LoadUint64(&slot.published) != seq+1 {
+		return false
+	}
+	for _, dep := range c.deps {
+		if atomic.LoadUint64(&dep.cursor) <= seq {
+			return false
+		}
+	}
+	return true
+}
+
+// drained reports whether no item will ever be available at seq, once the
+// queue is closed: none has been claimed, or the consumers c depends on are
+// drained as well.
+func (c *MulticastConsumer[T]) drained(seq uint64) bool {
+	if seq >= atomic.LoadUint64(&c.mq.next) {
+		return true
+	}
+	for _, dep := range c.deps {
+		if cursor := atomic.LoadUint64(&dep.cursor); cursor <= seq && dep.drained(cursor) {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of items the consumer has yet to see.
+func (c *MulticastConsumer[T]) Len() int {
+	next, cursor := atomic.LoadUint64(&c.mq.next), atomic.LoadUint64(&c.cursor)
+	if cursor >= next {
+		return 0
+	}
+	return int(next - cursor)
+}
+
+// Empty returns whether the consumer has seen every item.
+func (c *MulticastConsumer[T]) Empty() bool {
+	return c.Len() == 0
+}
+
+// Close closes the queue and wakes up all blocked producers and consumers.
+// Further pushes return ErrClosed, while consumers keep returning the
+// remaining items until they are drained. Close is idempotent.
+func (mq *MulticastRingQueue[T]) Close() {
+	mq.closer.Do(func() {
+		close(mq.done)
+	})
+}
+
+// IsClosed reports whether the queue has been closed.
+func (mq *MulticastRingQueue[T]) IsClosed() bool {
+	return isDone(mq.done)
+}
+
+// Len returns the number of items that the slowest consumer has yet to see.
+func (mq *MulticastRingQueue[T]) Len() int {
+	return int(atomic.LoadUint64(&mq.next) - mq.minCursor())
+}
+
+// Empty returns whether every consumer has seen every item.
+func (mq *MulticastRingQueue[T]) Empty() bool {
+	return mq.Len() == 0
+}
@@ -0,0 +1,252 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMulticastRingQueuePushPop(t *testing.T) {
+	mq := NewMulticastRingQueue[int](2, BlockingWait{})
+	c1 := mq.Subscribe()
+	c2 := mq.Subscribe()
+
+	assert.True(t, mq.Empty())
+	assert.Nil(t, mq.Push(1, 0))
+	assert.Nil(t, mq.Push(2, 0))
+	assert.Equal(t, ErrFull, mq.Push(3, 0))
+	assert.Equal(t, ErrTimeout, mq.Push(3, time.Millisecond))
+	assert.Equal(t, 2, mq.Len())
+	assert.Equal(t, 2, c1.Len())
+
+	// every consumer sees every item
+	val, err := c1.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	assert.Equal(t, ErrFull, mq.Push(3, 0)) // c2 is the slowest
+	val, err = c2.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	assert.Nil(t, mq.Push(3, 0))
+
+	for _, c := range []*MulticastConsumer[int]{c1, c2} {
+		for i := 2; i <= 3; i++ {
+			val, err = c.Pop()
+			assert.Nil(t, err)
+			assert.Equal(t, i, val)
+		}
+		val, err = c.Pop(0)
+		assert.Equal(t, ErrEmpty, err)
+		assert.Zero(t, val)
+		val, err = c.Pop(time.Millisecond)
+		assert.Equal(t, ErrTimeout, err)
+		assert.Zero(t, val)
+		assert.True(t, c.Empty())
+	}
+	assert.True(t, mq.Empty())
+}
+
+func TestMulticastRingQueueDependencies(t *testing.T) {
+	mq := NewMulticastRingQueue[int](4, BlockingWait{})
+	first := mq.Subscribe()
+	second := mq.Subscribe(first)
+
+	mq.Push(1)
+	mq.Push(2)
+
+	// second only sees the items first has seen
+	val, err := second.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+	assert.Zero(t, val)
+
+	val, err = first.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	val, err = second.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	_, err = second.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		val, err := first.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, 2, val)
+	}()
+	val, err = second.PopContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+
+	// once first is gone, second no longer waits for it
+	mq.Push(3)
+	first.Unsubscribe()
+	val, err = second.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+}
+
+func TestMulticastRingQueueUnsubscribe(t *testing.T) {
+	mq := NewMulticastRingQueue[int](1, BlockingWait{})
+	fast := mq.Subscribe()
+	slow := mq.Subscribe()
+
+	mq.Push(1)
+	fast.Pop()
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		slow.Unsubscribe()
+	}()
+	assert.Nil(t, mq.Push(2))
+
+	val, err := fast.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+}
+
+func TestMulticastRingQueueUnsubscribeDependent(t *testing.T) {
+	mq := NewMulticastRingQueue[int](1, BlockingWait{})
+	first := mq.Subscribe()
+	second := mq.Subscribe(first)
+	third := mq.Subscribe(first)
+
+	second.Unsubscribe()
+	assert.Equal(t, []*MulticastConsumer[int]{third}, *first.dependents.Load())
+	third.Unsubscribe()
+	assert.Empty(t, *first.dependents.Load())
+}
+
+// parkCounter is a BlockingWait that counts the waits.
+type parkCounter struct {
+	waits atomic.Int64
+}
+
+func (p *parkCounter) Wait(attempt int, cond *WaitCond) {
+	p.waits.Add(1)
+	cond.Park(0)
+}
+
+func (p *parkCounter) Parks() bool {
+	return true
+}
+
+func TestMulticastRingQueueCloseWaitsForDependency(t *testing.T) {
+	wait := &parkCounter{}
+	mq := NewMulticastRingQueue[int](2, wait)
+	first := mq.Subscribe()
+	second := mq.Subscribe(first)
+	mq.Push(1)
+	mq.Close()
+
+	// the closed queue does not keep waking up second while first has
+	// yet to see the item
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		first.Pop()
+	}()
+	val, err := second.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	assert.LessOrEqual(t, wait.waits.Load(), int64(2))
+
+	_, err = second.Pop()
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestMulticastRingQueueSpinClose(t *testing.T) {
+	testMulticastRingQueueClose(t, BusySpinWait{})
+}
+
+func TestMulticastRingQueueChannelClose(t *testing.T) {
+	testMulticastRingQueueClose(t, BlockingWait{})
+}
+
+func testMulticastRingQueueClose(t *testing.T, wait WaitStrategy) {
+	mq := NewMulticastRingQueue[int](1, wait)
+	first := mq.Subscribe()
+	second := mq.Subscribe(first)
+	mq.Push(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, mq.PushContext(ctx, 2))
+
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		mq.Close()
+	}()
+	assert.Equal(t, ErrClosed, mq.Push(2))
+	assert.True(t, mq.IsClosed())
+	mq.Close()
+
+	// the remaining item is still seen by every consumer
+	val, err := first.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	val, err = second.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+
+	_, err = first.Pop()
+	assert.Equal(t, ErrClosed, err)
+	_, err = second.Pop()
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestMulticastRingQueueConcurrent(t *testing.T) {
+	for name, wait := range waitStrategies {
+		t.Run(name, func(t *testing.T) {
+			testMulticastRingQueueConcurrent(t, wait)
+		})
+	}
+}
+
+func testMulticastRingQueueConcurrent(t *testing.T, wait WaitStrategy) {
+	const producers, perProducer = 2, 200
+	mq := NewMulticastRingQueue[int](16, wait)
+	a := mq.Subscribe()
+	b := mq.Subscribe()
+	c := mq.Subscribe(a, b)
+
+	var pwg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		pwg.Add(1)
+		go func(p int) {
+			defer pwg.Done()
+			for i := 0; i < perProducer; i++ {
+				assert.Nil(t, mq.Push(p*perProducer+i))
+			}
+		}(p)
+	}
+	go func() {
+		pwg.Wait()
+		mq.Close()
+	}()
+
+	var cwg sync.WaitGroup
+	sums := make([]int, 3)
+	for i, consumer := range []*MulticastConsumer[int]{a, b, c} {
+		cwg.Add(1)
+		go func(i int, consumer *MulticastConsumer[int]) {
+			defer cwg.Done()
+			for {
+				val, err := consumer.Pop()
+				if err == ErrClosed {
+					return
+				}
+				assert.Nil(t, err)
+				sums[i] += val
+			}
+		}(i, consumer)
+	}
+	cwg.Wait()
+
+	n := producers * perProducer
+	for _, sum := range sums {
+		assert.Equal(t, n*(n-1)/2, sum)
+	}
+}
@@ -0,0 +1,214 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// Op is a queue operation reported to an Observer.
+type Op int
+
+const (
+	OpPush Op = iota
+	OpPop
+	OpClose
+)
+
+// Observer receives the outcome of every operation on an ObservedQueue:
+// its error, if any, the depth of the queue right after it, and how long
+// it took, which is mostly the time spent blocked. It is called from the
+// goroutine of the operation, so it must be safe for concurrent use and fast.
+type Observer interface {
+	Observe(op Op, err error, depth int, elapsed time.Duration)
+}
+
+// ObservedQueue wraps a queue to report its operations to an Observer.
+// It is as safe for concurrent use as the wrapped queue.
+type ObservedQueue[T any] struct {
+	Interface[T]
+	observer Observer
+}
+
+// NewObservedQueue wraps the queue q to report its operations to observer.
+func NewObservedQueue[T any](q Interface[T], observer Observer) *ObservedQueue[T] {
+	return &ObservedQueue[T]{
+		Interface: q,
+		observer:  observer,
+	}
+}
+
+// Push adds the item to the wrapped queue, and reports the outcome.
+func (oq *ObservedQueue[T]) Push(item T, timeout ...time.Duration) error {
+	start := time.Now()
+	err := oq.Interface.Push(item, timeout...)
+	oq.observer.Observe(OpPush, err, oq.Interface.Len(), time.Since(start))
+	return err
+}
+
+// Pop removes an item from the wrapped queue, and reports the outcome.
+func (oq *ObservedQueue[T]) Pop(timeout ...time.Duration) (T, error) {
+	start := time.Now()
+	item, err := oq.Interface.Pop(timeout...)
+	oq.observer.Observe(OpPop, err, oq.Interface.Len(), time.Since(start))
+	return item, err
+}
+
+// contextPusher and contextPopper are implemented by the queues that can
+// block on a context, some of which can only pop with one.
+type contextPusher[T any] interface {
+	PushContext(ctx context.Context, item T) error
+}
+
+type contextPopper[T any] interface {
+	PopContext(ctx context.Context) (T, error)
+}
+
+// pollWait is how PushContext and PopContext wait on a wrapped queue that
+// cannot block on a context.
+var pollWait WaitStrategy = TimedParkWait{}
+
+// PushContext adds the item to the wrapped queue with its PushContext, and
+// reports the outcome. If the wrapped queue has none, it is pushed to with
+// a zero timeout until it is not full or ctx is done.
+func (oq *ObservedQueue[T]) PushContext(ctx context.Context, item T) error {
+	start := time.Now()
+	var err error
+	if cq, ok := oq.Interface.(contextPusher[T]); ok {
+		err = cq.PushContext(ctx, item)
+	} else {
+		w := newWaiter(ctx, nil)
+		for {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			if err = oq.Interface.Push(item, 0); err != ErrFull {
+				break
+			}
+			if err = w.wait(pollWait, nil, nil, ErrFull); err != nil {
+				break
+			}
+		}
+	}
+	oq.observer.Observe(OpPush, err, oq.Interface.Len(), time.Since(start))
+	return err
+}
+
+// PopContext removes an item from the wrapped queue with its PopContext,
+// and reports the outcome. If the wrapped queue has none, it is popped from
+// with a zero timeout until it is not empty or ctx is done.
+func (oq *ObservedQueue[T]) PopContext(ctx context.Context) (T, error) {
+	start := time.Now()
+	var item T
+	var err error
+	if cq, ok := oq.Interface.(contextPopper[T]); ok {
+		item, err = cq.PopContext(ctx)
+	} else {
+		w := newWaiter(ctx, nil)
+		for {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			if item, err = oq.Interface.Pop(0); err != ErrEmpty {
+				break
+			}
+			if err = w.wait(pollWait, nil, nil, ErrEmpty); err != nil {
+				break
+			}
+		}
+	}
+	oq.observer.Observe(OpPop, err, oq.Interface.Len(), time.Since(start))
+	return item, err
+}
+
+// Close closes the wrapped queue, if it can be closed, and reports the
+// outcome. It returns the error of the Close of the wrapped queue, if any.
+func (oq *ObservedQueue[T]) Close() error {
+	start := time.Now()
+	var err error
+	switch q := oq.Interface.(type) {
+	case interface{ Close() error }:
+		err = q.Close()
+	case interface{ Close() }:
+		q.Close()
+	}
+	oq.observer.Observe(OpClose, err, oq.Interface.Len(), time.Since(start))
+	return err
+}
+
+// Unwrap returns the wrapped queue, for its methods beyond Interface.
+// Operations through it are not reported.
+func (oq *ObservedQueue[T]) Unwrap() Interface[T] {
+	return oq.Interface
+}
+
+// Metrics is an Observer that counts the operations in memory.
+// The zero value is ready to use.
+type Metrics struct {
+	pushes        atomic.Uint64
+	pops          atomic.Uint64
+	timeouts      atomic.Uint64
+	full          atomic.Uint64
+	empty         atomic.Uint64
+	highWatermark atomic.Int64
+	latency       atomic.Int64
+}
+
+// MetricsSnapshot holds the values of Metrics at an instant.
+type MetricsSnapshot struct {
+	Pushes        uint64        `json:"pushes"`         // successful pushes
+	Pops          uint64        `json:"pops"`           // successful pops
+	Timeouts      uint64        `json:"timeouts"`       // operations that timed out
+	Full          uint64        `json:"full"`           // pushes rejected with ErrFull
+	Empty         uint64        `json:"empty"`          // pops rejected with ErrEmpty
+	HighWatermark int           `json:"high_watermark"` // highest depth seen
+	Latency       time.Duration `json:"latency_ns"`     // total time spent in operations
+}
+
+// Observe implements Observer.
+func (m *Metrics) Observe(op Op, err error, depth int, elapsed time.Duration) {
+	switch {
+	case err == nil && op == OpPush:
+		m.pushes.Add(1)
+	case err == nil && op == OpPop:
+		m.pops.Add(1)
+	case err == ErrTimeout || errors.Is(err, context.DeadlineExceeded):
+		m.timeouts.Add(1)
+	case err == ErrFull:
+		m.full.Add(1)
+	case err == ErrEmpty:
+		m.empty.Add(1)
+	}
+
+	for {
+		high := m.highWatermark.Load()
+		if int64(depth) <= high || m.highWatermark.CompareAndSwap(high, int64(depth)) {
+			break
+		}
+	}
+	m.latency.Add(int64(elapsed))
+}
+
+// Snapshot returns the current values of the metrics.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	return MetricsSnapshot{
+		Pushes:        m.pushes.Load(),
+		Pops:          m.pops.Load(),
+		Timeouts:      m.timeouts.Load(),
+		Full:          m.full.Load(),
+		Empty:         m.empty.Load(),
+		HighWatermark: int(m.highWatermark.Load()),
+		Latency:       time.Duration(m.latency.Load()),
+	}
+}
+
+// Publish exports the metrics with expvar under the name, so that they are
+// served as JSON at /debug/vars. Like expvar.Publish, it panics if the name
+// is already in use.
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return m.Snapshot()
+	}))
+}
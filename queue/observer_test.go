@@ -0,0 +1,197 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObservedQueueMetrics(t *testing.T) {
+	var m Metrics
+	q := NewObservedQueue[int](NewRingQueue[int](2, BlockingWait{}), &m)
+
+	assert.Nil(t, q.Push(1))
+	assert.Nil(t, q.Push(2))
+	assert.Equal(t, ErrFull, q.Push(3, 0))
+	assert.Equal(t, ErrTimeout, q.Push(3, time.Millisecond))
+
+	val, err := q.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	q.Pop()
+	_, err = q.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+
+	s := m.Snapshot()
+	assert.Equal(t, uint64(2), s.Pushes)
+	assert.Equal(t, uint64(2), s.Pops)
+	assert.Equal(t, uint64(1), s.Timeouts)
+	assert.Equal(t, uint64(1), s.Full)
+	assert.Equal(t, uint64(1), s.Empty)
+	assert.Equal(t, 2, s.HighWatermark)
+	assert.True(t, s.Latency >= time.Millisecond)
+}
+
+// observation is a call to an Observer.
+type observation struct {
+	op    Op
+	err   error
+	depth int
+}
+
+// recorder is an Observer that records the calls, for tests.
+type recorder struct {
+	observations []observation
+}
+
+func (r *recorder) Observe(op Op, err error, depth int, elapsed time.Duration) {
+	r.observations = append(r.observations, observation{op, err, depth})
+}
+
+func TestObservedQueueContext(t *testing.T) {
+	var m Metrics
+	r := &recorder{}
+	q := NewObservedQueue[int](NewChannelQueue[int](1), r)
+
+	assert.Nil(t, q.PushContext(context.Background(), 1))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, q.PushContext(ctx, 2))
+	val, err := q.PopContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	_, err = q.PopContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, q.Close())
+	assert.True(t, q.Unwrap().(*ChannelQueue[int]).IsClosed())
+
+	assert.Equal(t, []observation{
+		{OpPush, nil, 1},
+		{OpPush, context.DeadlineExceeded, 1},
+		{OpPop, nil, 0},
+		{OpPop, context.DeadlineExceeded, 0},
+		{OpClose, nil, 0},
+	}, r.observations)
+
+	for _, o := range r.observations {
+		m.Observe(o.op, o.err, o.depth, 0)
+	}
+	s := m.Snapshot()
+	assert.Equal(t, uint64(1), s.Pushes)
+	assert.Equal(t, uint64(1), s.Pops)
+	assert.Equal(t, uint64(2), s.Timeouts)
+}
+
+func TestObservedQueueContextFallback(t *testing.T) {
+	r := &recorder{}
+	q := NewObservedQueue[int](NewQueue[int](), r)
+
+	assert.Nil(t, q.PushContext(context.Background(), 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, q.PushContext(ctx, 2))
+	_, err := q.PopContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+	val, err := q.PopContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+
+	// a queue that cannot be closed is left as is
+	assert.Nil(t, q.Close())
+	assert.Equal(t, OpClose, r.observations[len(r.observations)-1].op)
+
+	// a queue that cannot block on a context is polled until ctx is done
+	dq, err := NewDiskQueue[int](t.TempDir(), JSONCodec[int]{})
+	assert.Nil(t, err)
+	q = NewObservedQueue[int](dq, r)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		dq.Push(3)
+	}()
+	val, err = q.PopContext(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+	start := time.Now()
+	_, err = q.PopContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	assert.Nil(t, q.Close())
+	assert.Nil(t, q.Close())
+	assert.Equal(t, ErrClosed, q.PushContext(context.Background(), 1))
+}
+
+func TestObservedQueuePopContextOnly(t *testing.T) {
+	r := &recorder{}
+	q := NewObservedQueue[int](NewLinkedQueue[int](BlockingWait{}), r)
+
+	// LinkedQueue pops with a context, but never blocks pushing
+	assert.Nil(t, q.PushContext(context.Background(), 1))
+	val, err := q.PopContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = q.PopContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestObservedQueueConcurrent(t *testing.T) {
+	var m Metrics
+	q := NewObservedQueue[int](NewChannelQueue[int](4), &m)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 100; k++ {
+				assert.Nil(t, q.Push(k))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 100; k++ {
+				_, err := q.Pop()
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := m.Snapshot()
+	assert.Equal(t, uint64(400), s.Pushes)
+	assert.Equal(t, uint64(400), s.Pops)
+	assert.True(t, s.HighWatermark <= 4)
+}
+
+// published counts the runs of TestMetricsPublish, as expvar names cannot
+// be reused when the test is run more than once.
+var published atomic.Int64
+
+func TestMetricsPublish(t *testing.T) {
+	name := fmt.Sprintf("queue_test_metrics_%d", published.Add(1))
+	var m Metrics
+	q := NewObservedQueue[int](NewQueue[int](), &m)
+	q.Push(1)
+	m.Publish(name)
+
+	var s MetricsSnapshot
+	assert.Nil(t, json.Unmarshal([]byte(expvar.Get(name).String()), &s))
+	assert.Equal(t, uint64(1), s.Pushes)
+	assert.Equal(t, 1, s.HighWatermark)
+
+	assert.Panics(t, func() { m.Publish(name) })
+}
@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy determines what pushing to a full bounded queue does.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the push as the queue itself does,
+	// following the timeout rules of its Push.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject immediately fails the push with ErrFull.
+	OverflowReject
+	// OverflowDropNewest discards the pushed item.
+	OverflowDropNewest
+	// OverflowDropOldest pops and discards items from the queue
+	// until there is room for the pushed item.
+	OverflowDropOldest
+)
+
+// OverflowQueue wraps a bounded queue, such as a RingQueue or ChannelQueue,
+// to apply an OverflowPolicy when it is full. It is as safe for concurrent
+// use as the wrapped queue, except that OverflowDropOldest pops from the
+// producer side, which a SPSCRingQueue does not allow.
+type OverflowQueue[T any] struct {
+	Interface[T]
+	policy  OverflowPolicy
+	onDrop  func(item T)
+	dropped atomic.Uint64
+}
+
+// NewOverflowQueue wraps the queue q with the overflow policy. If onDrop is
+// specified, it is called with every item dropped by the policy.
+func NewOverflowQueue[T any](q Interface[T], policy OverflowPolicy, onDrop ...func(item T)) *OverflowQueue[T] {
+	if policy < OverflowBlock || policy > OverflowDropOldest {
+		panic("unknown OverflowPolicy")
+	}
+	oq := &OverflowQueue[T]{
+		Interface: q,
+		policy:    policy,
+	}
+	if len(onDrop) > 0 {
+		oq.onDrop = onDrop[0]
+	}
+	return oq
+}
+
+// Push adds the item to the queue. If the queue is full, OverflowBlock waits
+// as the wrapped queue does, OverflowReject returns ErrFull, and both
+// OverflowDropNewest and OverflowDropOldest drop an item and return nil.
+// Errors of the wrapped queue other than ErrFull, like ErrClosed, are returned as is.
+func (oq *OverflowQueue[T]) Push(item T, timeout ...time.Duration) error {
+	if oq.policy == OverflowBlock {
+		return oq.Interface.Push(item, timeout...)
+	}
+
+	w := newWaiter(context.Background(), nil)
+	for {
+		err := oq.Interface.Push(item, 0)
+		if err != ErrFull {
+			return err
+		}
+
+		switch oq.policy {
+		case OverflowReject:
+			return ErrFull
+		case OverflowDropNewest:
+			oq.drop(item)
+			return nil
+		case OverflowDropOldest:
+			// the pop may find the queue empty if consumers got ahead, or
+			// if the pushes that filled it have yet to store their items,
+			// in which case the push is retried, yielding to them
+			if oldest, err := oq.Interface.Pop(0); err == nil {
+				oq.drop(oldest)
+			} else if err != ErrEmpty {
+				return err
+			} else {
+				w.retry(YieldingWait{}, nil)
+			}
+		}
+	}
+}
+
+func (oq *OverflowQueue[T]) drop(item T) {
+	oq.dropped.Add(1)
+	if oq.onDrop != nil {
+		oq.onDrop(item)
+	}
+}
+
+// Dropped returns the number of items dropped by the overflow policy.
+func (oq *OverflowQueue[T]) Dropped() uint64 {
+	return oq.dropped.Load()
+}
+
+// Unwrap returns the wrapped queue, for its methods beyond Interface.
+func (oq *OverflowQueue[T]) Unwrap() Interface[T] {
+	return oq.Interface
+}
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverflowQueueBlock(t *testing.T) {
+	oq := NewOverflowQueue[int](NewRingQueue[int](2, BlockingWait{}), OverflowBlock)
+
+	assert.Nil(t, oq.Push(1))
+	assert.Nil(t, oq.Push(2))
+	assert.Equal(t, ErrFull, oq.Push(3, 0))
+	assert.Equal(t, ErrTimeout, oq.Push(3, time.Millisecond))
+
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		val, err := oq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, val)
+	}()
+	assert.Nil(t, oq.Push(3))
+	assert.Zero(t, oq.Dropped())
+}
+
+func TestOverflowQueueUnknownPolicy(t *testing.T) {
+	assert.Panics(t, func() {
+		NewOverflowQueue[int](NewChannelQueue[int](2), OverflowDropOldest+1)
+	})
+	assert.Panics(t, func() {
+		NewOverflowQueue[int](NewChannelQueue[int](2), -1)
+	})
+}
+
+func TestOverflowQueueReject(t *testing.T) {
+	oq := NewOverflowQueue[int](NewChannelQueue[int](2), OverflowReject)
+
+	assert.Nil(t, oq.Push(1))
+	assert.Nil(t, oq.Push(2))
+	assert.Equal(t, ErrFull, oq.Push(3))
+	assert.Equal(t, 2, oq.Len())
+	assert.Zero(t, oq.Dropped())
+}
+
+func TestOverflowQueueDropNewest(t *testing.T) {
+	var dropped []int
+	oq := NewOverflowQueue[int](NewRingQueue[int](2, BlockingWait{}), OverflowDropNewest, func(item int) {
+		dropped = append(dropped, item)
+	})
+
+	for i := 1; i <= 5; i++ {
+		assert.Nil(t, oq.Push(i))
+	}
+	assert.Equal(t, []int{3, 4, 5}, dropped)
+	assert.EqualValues(t, 3, oq.Dropped())
+	assert.Equal(t, 1, popValue[int](t, oq))
+	assert.Equal(t, 2, popValue[int](t, oq))
+}
+
+func TestOverflowQueueDropOldest(t *testing.T) {
+	var dropped []int
+	oq := NewOverflowQueue[int](NewChannelQueue[int](2), OverflowDropOldest, func(item int) {
+		dropped = append(dropped, item)
+	})
+
+	for i := 1; i <= 5; i++ {
+		assert.Nil(t, oq.Push(i))
+	}
+	assert.Equal(t, []int{1, 2, 3}, dropped)
+	assert.EqualValues(t, 3, oq.Dropped())
+	assert.Equal(t, 4, popValue[int](t, oq))
+	assert.Equal(t, 5, popValue[int](t, oq))
+
+	rq := NewRingQueue[int](2, BlockingWait{})
+	oq = NewOverflowQueue[int](rq, OverflowDropOldest)
+	assert.Same(t, rq, oq.Unwrap())
+	rq.Close()
+	assert.Equal(t, ErrClosed, oq.Push(1))
+}
+
+func TestOverflowQueueDropOldestInFlight(t *testing.T) {
+	rq := NewRingQueue[int](2, BlockingWait{})
+	oq := NewOverflowQueue[int](rq, OverflowDropOldest)
+
+	// two pushes have reserved the nodes, so the queue is full, but they
+	// have not stored their items yet, so it is empty too
+	atomic.AddUint64(&rq.tail, 2)
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		for i, n := range rq.nodes {
+			n.data = i + 1
+			atomic.StoreUint64(&n.position, uint64(i+1))
+		}
+	}()
+	assert.Nil(t, oq.Push(3))
+	assert.EqualValues(t, 1, oq.Dropped())
+	assert.Equal(t, 2, popValue[int](t, oq))
+	assert.Equal(t, 3, popValue[int](t, oq))
+}
+
+func TestOverflowQueueDropOldestConcurrent(t *testing.T) {
+	const producers, items = 4, 1000
+	oq := NewOverflowQueue[int](NewRingQueue[int](8, BlockingWait{}), OverflowDropOldest)
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < items; i++ {
+				assert.Nil(t, oq.Push(i))
+			}
+		}()
+	}
+
+	popped := 0
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for !isDone(done) || !oq.Empty() {
+		if _, err := oq.Pop(time.Millisecond); err == nil {
+			popped++
+		}
+	}
+	assert.EqualValues(t, producers*items, uint64(popped)+oq.Dropped())
+}
@@ -0,0 +1,389 @@
+package queue
+
+// dheap is a 4-ary heap.
+type dheap[T any] struct {
+	pcompare[T]
+	items []pentry[T]
+}
+
+const dheapArity = 4
+
+func (h *dheap[T]) swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	if h.items[i].handle != nil {
+		h.items[i].handle.index = i
+	}
+	if h.items[j].handle != nil {
+		h.items[j].handle.index = j
+	}
+}
+
+func (h *dheap[T]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / dheapArity
+		if !h.before(&h.items[i], &h.items[parent]) {
+			return
+		}
+		h.swap(i, parent)
+		i = parent
+	}
+}
+
+// down reports whether the entry at the index i moved.
+func (h *dheap[T]) down(i int) bool {
+	i0 := i
+	n := len(h.items)
+	for {
+		first := dheapArity*i + 1
+		if first >= n {
+			break
+		}
+		best := first
+		for c := first + 1; c < first+dheapArity && c < n; c++ {
+			if h.before(&h.items[c], &h.items[best]) {
+				best = c
+			}
+		}
+		if !h.before(&h.items[best], &h.items[i]) {
+			break
+		}
+		h.swap(i, best)
+		i = best
+	}
+	return i > i0
+}
+
+func (h *dheap[T]) push(entry pentry[T]) {
+	if entry.handle != nil {
+		entry.handle.index = len(h.items)
+	}
+	h.items = append(h.items, entry)
+	h.up(len(h.items) - 1)
+}
+
+func (h *dheap[T]) pop() pentry[T] {
+	return h.removeAt(0)
+}
+
+func (h *dheap[T]) removeAt(i int) pentry[T] {
+	n := len(h.items) - 1
+	h.swap(i, n)
+	entry := h.items[n]
+	if entry.handle != nil {
+		entry.handle.index = -1
+	}
+	h.items[n] = pentry[T]{}
+	h.items = h.items[:n]
+	if i < n && !h.down(i) {
+		h.up(i)
+	}
+	return entry
+}
+
+func (h *dheap[T]) peek() *pentry[T] {
+	return &h.items[0]
+}
+
+func (h *dheap[T]) entry(handle *Item[T]) *pentry[T] {
+	return arrayEntry(h.items, handle)
+}
+
+func (h *dheap[T]) fix(handle *Item[T]) {
+	if !h.down(handle.index) {
+		h.up(handle.index)
+	}
+}
+
+func (h *dheap[T]) remove(handle *Item[T]) {
+	h.removeAt(handle.index)
+}
+
+func (h *dheap[T]) merge(other pheap[T]) {
+	h.items = takeEntries(h.items, other)
+	h.init()
+}
+
+func (h *dheap[T]) reorder(update func(entry *pentry[T])) {
+	for i := range h.items {
+		update(&h.items[i])
+	}
+	h.init()
+}
+
+// init heapifies the items in O(n).
+func (h *dheap[T]) init() {
+	for i := (len(h.items) - 2) / dheapArity; i >= 0; i-- {
+		h.down(i)
+	}
+}
+
+func (h *dheap[T]) entries() []pentry[T] {
+	return copyEntries(h.items)
+}
+
+func (h *dheap[T]) compare() *pcompare[T] {
+	return &h.pcompare
+}
+
+func (h *dheap[T]) len() int {
+	return len(h.items)
+}
+
+// arrayEntry returns the entry of the handle in the items of an array heap,
+// or nil if it is not there.
+func arrayEntry[T any](items []pentry[T], handle *Item[T]) *pentry[T] {
+	if handle == nil || handle.index < 0 || handle.index >= len(items) ||
+		items[handle.index].handle != handle {
+		return nil
+	}
+	return &items[handle.index]
+}
+
+// takeEntries moves the entries of the other heap to the end of the items
+// of an array heap, which must then be heapified.
+func takeEntries[T any](items []pentry[T], other pheap[T]) []pentry[T] {
+	n := len(items)
+	switch o := other.(type) {
+	case *pqueue[T]:
+		items = append(items, o.items...)
+		o.items = nil
+	case *dheap[T]:
+		items = append(items, o.items...)
+		o.items = nil
+	default:
+		for other.len() > 0 {
+			items = append(items, other.pop())
+		}
+	}
+	for i := n; i < len(items); i++ {
+		if items[i].handle != nil {
+			items[i].handle.index = i
+		}
+	}
+	return items
+}
+
+func copyEntries[T any](items []pentry[T]) []pentry[T] {
+	entries := make([]pentry[T], len(items))
+	for i, e := range items {
+		entries[i] = pentry[T]{value: e.value, seq: e.seq}
+	}
+	return entries
+}
+
+// pairheap is a pairing heap, after Fredman et al.: a tree whose root is
+// the first entry, and whose subtrees are paired up when the root is popped.
+type pairheap[T any] struct {
+	pcompare[T]
+	root  *pairnode[T]
+	n     int
+	owner *pairowner
+	pairs []*pairnode[T] // reused by mergePairs
+}
+
+type pairnode[T any] struct {
+	entry pentry[T]
+	child *pairnode[T] // the first child
+	next  *pairnode[T] // the next sibling
+	prev  *pairnode[T] // the previous sibling, or the parent of the first child
+	owner *pairowner
+}
+
+// pairowner tells which heap a node is in. Merging a heap forwards its
+// owner to that of the heap it is merged into, so that its nodes need not
+// be visited.
+type pairowner struct {
+	next *pairowner
+}
+
+func newPairheap[T any](compare pcompare[T]) *pairheap[T] {
+	return &pairheap[T]{pcompare: compare, owner: &pairowner{}}
+}
+
+// meld links the roots a and b, either of which may be nil, and returns
+// the new root.
+func (h *pairheap[T]) meld(a, b *pairnode[T]) *pairnode[T] {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if h.before(&b.entry, &a.entry) {
+		a, b = b, a
+	}
+	b.prev = a
+	b.next = a.child
+	if a.child != nil {
+		a.child.prev = b
+	}
+	a.child = b
+	return a
+}
+
+// mergePairs melds the siblings from first on, pairing them up from left
+// to right, then melding the pairs from right to left.
+func (h *pairheap[T]) mergePairs(first *pairnode[T]) *pairnode[T] {
+	for first != nil {
+		a, b := first, first.next
+		a.prev, a.next = nil, nil
+		if b == nil {
+			h.pairs = append(h.pairs, a)
+			break
+		}
+		first = b.next
+		b.prev, b.next = nil, nil
+		h.pairs = append(h.pairs, h.meld(a, b))
+	}
+
+	var root *pairnode[T]
+	for i := len(h.pairs) - 1; i >= 0; i-- {
+		root = h.meld(h.pairs[i], root)
+		h.pairs[i] = nil
+	}
+	h.pairs = h.pairs[:0]
+	return root
+}
+
+// cut detaches the node, which must not be the root, from its parent.
+func (h *pairheap[T]) cut(node *pairnode[T]) {
+	if node.prev.child == node {
+		node.prev.child = node.next
+	} else {
+		node.prev.next = node.next
+	}
+	if node.next != nil {
+		node.next.prev = node.prev
+	}
+	node.prev, node.next = nil, nil
+}
+
+// detach removes the node from the tree.
+func (h *pairheap[T]) detach(node *pairnode[T]) {
+	children := node.child
+	node.child = nil
+	if node == h.root {
+		h.root = h.mergePairs(children)
+		return
+	}
+	h.cut(node)
+	h.root = h.meld(h.root, h.mergePairs(children))
+}
+
+func (h *pairheap[T]) push(entry pentry[T]) {
+	node := &pairnode[T]{entry: entry, owner: h.owner}
+	if entry.handle != nil {
+		entry.handle.node = node
+	}
+	h.root = h.meld(h.root, node)
+	h.n++
+}
+
+func (h *pairheap[T]) pop() pentry[T] {
+	node := h.root
+	h.detach(node)
+	h.n--
+	if node.entry.handle != nil {
+		node.entry.handle.node = nil
+	}
+	return node.entry
+}
+
+func (h *pairheap[T]) peek() *pentry[T] {
+	return &h.root.entry
+}
+
+func (h *pairheap[T]) entry(handle *Item[T]) *pentry[T] {
+	if handle == nil || handle.node == nil {
+		return nil
+	}
+	node := handle.node
+	owner := node.owner
+	for owner.next != nil {
+		owner = owner.next
+	}
+	node.owner = owner
+	if owner != h.owner {
+		return nil
+	}
+	return &node.entry
+}
+
+func (h *pairheap[T]) fix(handle *Item[T]) {
+	node := handle.node
+	h.detach(node)
+	h.root = h.meld(h.root, node)
+}
+
+func (h *pairheap[T]) remove(handle *Item[T]) {
+	h.detach(handle.node)
+	h.n--
+	handle.node = nil
+}
+
+func (h *pairheap[T]) merge(other pheap[T]) {
+	if o, ok := other.(*pairheap[T]); ok {
+		h.root = h.meld(h.root, o.root)
+		h.n += o.n
+		o.owner.next = h.owner
+		o.owner = &pairowner{}
+		o.root = nil
+		o.n = 0
+		return
+	}
+	for other.len() > 0 {
+		h.push(other.pop())
+	}
+}
+
+// reorder unlinks all nodes into a list of siblings, and pairs them up again.
+func (h *pairheap[T]) reorder(update func(entry *pentry[T])) {
+	var first *pairnode[T]
+	h.walk(func(node *pairnode[T]) {
+		update(&node.entry)
+		node.child, node.prev = nil, nil
+		node.next = first
+		if first != nil {
+			first.prev = node
+		}
+		first = node
+	})
+	h.root = h.mergePairs(first)
+}
+
+func (h *pairheap[T]) entries() []pentry[T] {
+	entries := make([]pentry[T], 0, h.n)
+	h.walk(func(node *pairnode[T]) {
+		entries = append(entries, pentry[T]{value: node.entry.value, seq: node.entry.seq})
+	})
+	return entries
+}
+
+// walk calls visit on every node, which may unlink it.
+func (h *pairheap[T]) walk(visit func(node *pairnode[T])) {
+	// the tree may be as deep as it is large, so walk it without recursion
+	var stack []*pairnode[T]
+	if h.root != nil {
+		stack = append(stack, h.root)
+	}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for node != nil {
+			next := node.next
+			if node.child != nil {
+				stack = append(stack, node.child)
+			}
+			visit(node)
+			node = next
+		}
+	}
+}
+
+func (h *pairheap[T]) compare() *pcompare[T] {
+	return &h.pcompare
+}
+
+func (h *pairheap[T]) len() int {
+	return h.n
+}
@@ -1,70 +1,341 @@
-package queue
-
-import "container/heap"
-
-type PriorityQueue struct {
-	*pqueue
-}
-
-// Function comparePriority reports whether the element a has higher priority than the element b.
-func NewPriorityQueue(comparePriority func(a, b interface{}) bool, sizeHint ...int) *PriorityQueue {
-	pq := &pqueue{
-		comparePriority: comparePriority,
-	}
-	if len(sizeHint) > 0 {
-		pq.items = make([]interface{}, 0, sizeHint[0])
-	}
-	return &PriorityQueue{
-		pqueue: pq,
-	}
-}
-
-func (pq *PriorityQueue) Push(item interface{}) {
-	heap.Push(pq.pqueue, item)
-}
-
-func (pq *PriorityQueue) Pop() interface{} {
-	if len(pq.items) == 0 {
-		return nil
-	}
-	return heap.Pop(pq.pqueue)
-}
-
-
-func (pq *PriorityQueue) Len() int {
-	return len(pq.items)
-}
-
-func (pq *PriorityQueue) Empty() bool {
-	return len(pq.items) == 0
-}
-
-type pqueue struct {
-	items           []interface{}
-	comparePriority func(a, b interface{}) bool
-}
-
-func (pq *pqueue) Len() int {
-	return len(pq.items)
-}
-
-func (pq *pqueue) Less(i, j int) bool {
-	return pq.comparePriority(pq.items[i], pq.items[j])
-}
-
-func (pq *pqueue) Swap(i, j int) {
-	pq.items[i], pq.items[j] = pq.items[j], pq.items[i]
-}
-
-func (pq *pqueue) Push(item interface{}) {
-	pq.items = append(pq.items, item)
-}
-
-func (pq *pqueue) Pop() interface{} {
-	if len(pq.items) == 0 {
-		return nil
-	}
-	item := pq.items[len(pq.items)-1]
-	pq.items = pq.items[0:len(pq.items)-1]
-	return item
-}
+package queue
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+
+	"github.com/ridewindx/crumb/functional"
+)
+
+// HeapBackend selects the heap that a PriorityQueue is built on.
+type HeapBackend int
+
+const (
+	// BinaryHeap is a binary heap on container/heap.
+	BinaryHeap HeapBackend = iota
+	// QuaternaryHeap is a 4-ary heap, which is half as deep as a binary heap
+	// and compares siblings that share a cache line, so that it usually
+	// pops faster from large queues, at the cost of more comparisons.
+	QuaternaryHeap
+	// PairingHeap is a pairing heap, which pushes and merges in O(1) and
+	// pops in amortized O(log n), but allocates a node per item.
+	PairingHeap
+)
+
+// PriorityQueueOptions configures a PriorityQueue.
+type PriorityQueueOptions struct {
+	// SizeHint is the number of items to make room for up front.
+	// The pairing heap ignores it.
+	SizeHint int
+	// Backend defaults to BinaryHeap.
+	Backend HeapBackend
+	// Stable makes items of equal priority pop in the order they were
+	// pushed, as with NewStablePriorityQueue.
+	Stable bool
+}
+
+// PriorityQueue is an unbounded queue that pops items in priority order.
+// It is not safe for concurrent use.
+type PriorityQueue[T any] struct {
+	heap pheap[T]
+	seq  uint64 // insertion order of the next item
+}
+
+// Item is a handle to an item pushed into a PriorityQueue by PushItem,
+// which tracks the item's position in the heap.
+type Item[T any] struct {
+	// Value is the item. After changing any of its fields that affect its
+	// priority, call Update to restore the heap order.
+	Value T
+	index int          // index in an array heap, or -1 once the item has left the queue
+	node  *pairnode[T] // node in a pairing heap, or nil once the item has left the queue
+}
+
+// Function comparePriority reports whether the element a has higher priority than the element b.
+func NewPriorityQueue[T any](comparePriority func(a, b T) bool, sizeHint ...int) *PriorityQueue[T] {
+	return NewPriorityQueueWithOptions(comparePriority, sizeHintOptions(sizeHint))
+}
+
+// NewStablePriorityQueue is like NewPriorityQueue, but items of equal priority,
+// i.e. for which comparePriority is false both ways, are popped in the order
+// they were pushed.
+func NewStablePriorityQueue[T any](comparePriority func(a, b T) bool, sizeHint ...int) *PriorityQueue[T] {
+	options := sizeHintOptions(sizeHint)
+	options.Stable = true
+	return NewPriorityQueueWithOptions(comparePriority, options)
+}
+
+func sizeHintOptions(sizeHint []int) PriorityQueueOptions {
+	var options PriorityQueueOptions
+	if len(sizeHint) > 0 {
+		options.SizeHint = sizeHint[0]
+	}
+	return options
+}
+
+// NewPriorityQueueWithOptions is like NewPriorityQueue, but the options
+// select the backend, a size hint and whether the queue is stable.
+func NewPriorityQueueWithOptions[T any](comparePriority func(a, b T) bool, options PriorityQueueOptions) *PriorityQueue[T] {
+	compare := pcompare[T]{comparePriority: comparePriority, stable: options.Stable}
+	pq := &PriorityQueue[T]{}
+	switch options.Backend {
+	case QuaternaryHeap:
+		pq.heap = &dheap[T]{items: make([]pentry[T], 0, options.SizeHint), pcompare: compare}
+	case PairingHeap:
+		pq.heap = newPairheap(compare)
+	default:
+		pq.heap = &pqueue[T]{items: make([]pentry[T], 0, options.SizeHint), pcompare: compare}
+	}
+	return pq
+}
+
+// Push adds the item to the queue. It never fails.
+func (pq *PriorityQueue[T]) Push(item T, timeout ...time.Duration) error {
+	pq.push(pentry[T]{value: item})
+	return nil
+}
+
+// PushItem adds the item to the queue, and returns a handle to it
+// for Update, Remove and Contains.
+func (pq *PriorityQueue[T]) PushItem(item T) *Item[T] {
+	handle := &Item[T]{Value: item}
+	pq.push(pentry[T]{value: item, handle: handle})
+	return handle
+}
+
+func (pq *PriorityQueue[T]) push(entry pentry[T]) {
+	entry.seq = pq.seq
+	pq.seq++
+	pq.heap.push(entry)
+}
+
+// Pop removes and returns the item with the highest priority,
+// or returns ErrEmpty if the queue is empty.
+func (pq *PriorityQueue[T]) Pop(timeout ...time.Duration) (T, error) {
+	if pq.heap.len() == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return pq.heap.pop().value, nil
+}
+
+// Peek returns the item with the highest priority without removing it,
+// or returns ErrEmpty if the queue is empty.
+func (pq *PriorityQueue[T]) Peek() (T, error) {
+	if pq.heap.len() == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return pq.heap.peek().value, nil
+}
+
+// Snapshot returns a copy of the items in the queue, in the order they
+// would be popped, in O(n log n).
+func (pq *PriorityQueue[T]) Snapshot() []T {
+	entries := pq.heap.entries()
+	compare := pq.heap.compare()
+	sort.Slice(entries, func(i, j int) bool {
+		return compare.before(&entries[i], &entries[j])
+	})
+	items := make([]T, len(entries))
+	for i, e := range entries {
+		items[i] = e.value
+	}
+	return items
+}
+
+// Iterator returns an iterator over a Snapshot of the queue.
+func (pq *PriorityQueue[T]) Iterator() functional.Iterator {
+	return newSnapshotIterator(pq.Snapshot())
+}
+
+// Update restores the heap order after the priority of the item's Value
+// has changed, in O(log n). It reports whether the item is in the queue.
+func (pq *PriorityQueue[T]) Update(item *Item[T]) bool {
+	entry := pq.heap.entry(item)
+	if entry == nil {
+		return false
+	}
+	entry.value = item.Value
+	pq.heap.fix(item)
+	return true
+}
+
+// Remove removes the item from the queue in O(log n).
+// It reports whether the item was in the queue.
+func (pq *PriorityQueue[T]) Remove(item *Item[T]) bool {
+	if pq.heap.entry(item) == nil {
+		return false
+	}
+	pq.heap.remove(item)
+	return true
+}
+
+// Contains reports whether the item is still in the queue.
+func (pq *PriorityQueue[T]) Contains(item *Item[T]) bool {
+	return pq.heap.entry(item) != nil
+}
+
+// Merge moves all items of the other queue, which must order items the
+// same way, into this queue and leaves other empty. The handles of the
+// moved items now refer to this queue. It takes O(1) if both queues are
+// PairingHeap ones, and O(n + m) or O(m log(n + m)) otherwise. In a stable
+// queue, the moved items keep their order among themselves, but items of
+// equal priority from the two queues are not ordered by push time.
+func (pq *PriorityQueue[T]) Merge(other *PriorityQueue[T]) {
+	if other == pq {
+		return
+	}
+	pq.heap.merge(other.heap)
+	if other.seq > pq.seq {
+		pq.seq = other.seq
+	}
+}
+
+func (pq *PriorityQueue[T]) Len() int {
+	return pq.heap.len()
+}
+
+func (pq *PriorityQueue[T]) Empty() bool {
+	return pq.heap.len() == 0
+}
+
+// pentry is an item in the heap, along with its handle if it has one.
+type pentry[T any] struct {
+	value  T
+	handle *Item[T]
+	seq    uint64 // insertion order, to break ties in a stable queue
+}
+
+// pcompare orders the entries of a heap.
+type pcompare[T any] struct {
+	comparePriority func(a, b T) bool
+	stable          bool
+}
+
+// before reports whether the entry a is popped before the entry b.
+func (c *pcompare[T]) before(a, b *pentry[T]) bool {
+	if c.comparePriority(a.value, b.value) {
+		return true
+	}
+	if !c.stable || c.comparePriority(b.value, a.value) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+// pheap is a heap of entries that a PriorityQueue is built on.
+type pheap[T any] interface {
+	push(entry pentry[T])
+	// pop and peek must not be called on an empty heap.
+	pop() pentry[T]
+	peek() *pentry[T]
+	// entry returns the entry of the handle, or nil if it is not in the heap.
+	entry(handle *Item[T]) *pentry[T]
+	// fix and remove must only be called with handles in the heap.
+	fix(handle *Item[T])
+	remove(handle *Item[T])
+	// merge moves all entries of the other heap into this one.
+	merge(other pheap[T])
+	// reorder calls update on every entry, then restores the heap order.
+	reorder(update func(entry *pentry[T]))
+	// entries returns a copy of the entries without their handles,
+	// in no particular order.
+	entries() []pentry[T]
+	compare() *pcompare[T]
+	len() int
+}
+
+// pqueue is a binary heap on container/heap.
+type pqueue[T any] struct {
+	pcompare[T]
+	items []pentry[T]
+}
+
+func (pq *pqueue[T]) Len() int {
+	return len(pq.items)
+}
+
+func (pq *pqueue[T]) Less(i, j int) bool {
+	return pq.before(&pq.items[i], &pq.items[j])
+}
+
+func (pq *pqueue[T]) Swap(i, j int) {
+	pq.items[i], pq.items[j] = pq.items[j], pq.items[i]
+	if pq.items[i].handle != nil {
+		pq.items[i].handle.index = i
+	}
+	if pq.items[j].handle != nil {
+		pq.items[j].handle.index = j
+	}
+}
+
+func (pq *pqueue[T]) Push(item interface{}) {
+	entry := item.(pentry[T])
+	if entry.handle != nil {
+		entry.handle.index = len(pq.items)
+	}
+	pq.items = append(pq.items, entry)
+}
+
+func (pq *pqueue[T]) Pop() interface{} {
+	if len(pq.items) == 0 {
+		return nil
+	}
+	item := pq.items[len(pq.items)-1]
+	if item.handle != nil {
+		item.handle.index = -1
+	}
+	pq.items[len(pq.items)-1] = pentry[T]{}
+	pq.items = pq.items[0:len(pq.items)-1]
+	return item
+}
+
+func (pq *pqueue[T]) push(entry pentry[T]) {
+	heap.Push(pq, entry)
+}
+
+func (pq *pqueue[T]) pop() pentry[T] {
+	return heap.Pop(pq).(pentry[T])
+}
+
+func (pq *pqueue[T]) peek() *pentry[T] {
+	return &pq.items[0]
+}
+
+func (pq *pqueue[T]) entry(handle *Item[T]) *pentry[T] {
+	return arrayEntry(pq.items, handle)
+}
+
+func (pq *pqueue[T]) fix(handle *Item[T]) {
+	heap.Fix(pq, handle.index)
+}
+
+func (pq *pqueue[T]) remove(handle *Item[T]) {
+	heap.Remove(pq, handle.index)
+}
+
+func (pq *pqueue[T]) merge(other pheap[T]) {
+	pq.items = takeEntries(pq.items, other)
+	heap.Init(pq)
+}
+
+func (pq *pqueue[T]) reorder(update func(entry *pentry[T])) {
+	for i := range pq.items {
+		update(&pq.items[i])
+	}
+	heap.Init(pq)
+}
+
+func (pq *pqueue[T]) entries() []pentry[T] {
+	return copyEntries(pq.items)
+}
+
+func (pq *pqueue[T]) compare() *pcompare[T] {
+	return &pq.pcompare
+}
+
+func (pq *pqueue[T]) len() int {
+	return len(pq.items)
+}
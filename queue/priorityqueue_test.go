@@ -1,142 +1,463 @@
-package queue
-
-import (
-	"testing"
-	"github.com/stretchr/testify/assert"
-	"math/rand"
-	"time"
-)
-
-func TestPriorityQueuePushPop(t *testing.T) {
-	pq := NewPriorityQueue(func(a, b interface{}) bool {
-		return a.(int) > b.(int)
-	})
-
-	assert.True(t, pq.Empty())
-	assert.Zero(t, pq.Len())
-
-	pq.Push(4)
-	pq.Push(2)
-	pq.Push(5)
-	pq.Push(1)
-	pq.Push(3)
-
-	assert.Equal(t, 5, pq.Len())
-	assert.EqualValues(t, 5, pq.Pop())
-
-	pq.Push(3)
-
-	assert.EqualValues(t, 4, pq.Pop())
-	assert.EqualValues(t, 3, pq.Pop())
-	assert.EqualValues(t, 3, pq.Pop())
-
-	pq.Push(5)
-
-	assert.EqualValues(t, 5, pq.Pop())
-
-	assert.EqualValues(t, 2, pq.Pop())
-	assert.EqualValues(t, 1, pq.Pop())
-
-	assert.Zero(t, pq.Len())
-	assert.Nil(t, pq.Pop())
-}
-
-func BenchmarkPriorityQueuePushIncremental(b *testing.B) {
-	numItems := 1000000
-
-	pqs := make([]*PriorityQueue, 0, b.N)
-
-	for i := 0; i < b.N; i++ {
-		pq := NewPriorityQueue(func(a, b interface{}) bool {
-			return a.(int) > b.(int)
-		})
-		pqs = append(pqs, pq)
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		pq := pqs[i]
-		for j := 0; j < numItems; j++ {
-			pq.Push(j)
-		}
-	}
-}
-
-func BenchmarkPriorityQueuePopIncremental(b *testing.B) {
-	numItems := 1000000
-
-	pqs := make([]*PriorityQueue, 0, b.N)
-
-	for i := 0; i < b.N; i++ {
-		pq := NewPriorityQueue(func(a, b interface{}) bool {
-			return a.(int) > b.(int)
-		})
-		pqs = append(pqs, pq)
-	}
-
-	for i := 0; i < b.N; i++ {
-		pq := pqs[i]
-		for j := 0; j < numItems; j++ {
-			pq.Push(j)
-		}
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		pq := pqs[i]
-		for j := 0; j < numItems; j++ {
-			pq.Pop()
-		}
-	}
-}
-
-func BenchmarkPriorityQueuePushRandom(b *testing.B) {
-	numItems := 1000000
-
-	pqs := make([]*PriorityQueue, 0, b.N)
-
-	for i := 0; i < b.N; i++ {
-		pq := NewPriorityQueue(func(a, b interface{}) bool {
-			return a.(int) > b.(int)
-		})
-		pqs = append(pqs, pq)
-	}
-
-	r := rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		pq := pqs[i]
-		for j := 0; j < numItems; j++ {
-			pq.Push(r.Intn(numItems))
-		}
-	}
-}
-
-func BenchmarkPriorityQueuePopRandom(b *testing.B) {
-	numItems := 1000000
-
-	pqs := make([]*PriorityQueue, 0, b.N)
-
-	for i := 0; i < b.N; i++ {
-		pq := NewPriorityQueue(func(a, b interface{}) bool {
-			return a.(int) > b.(int)
-		})
-		pqs = append(pqs, pq)
-	}
-
-	r := rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
-	for i := 0; i < b.N; i++ {
-		pq := pqs[i]
-		for j := 0; j < numItems; j++ {
-			pq.Push(r.Intn(numItems))
-		}
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		pq := pqs[i]
-		for j := 0; j < numItems; j++ {
-			pq.Pop()
-		}
-	}
-}
+package queue
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func TestPriorityQueuePushPop(t *testing.T) {
+	pq := NewPriorityQueue(func(a, b int) bool {
+		return a > b
+	})
+
+	assert.True(t, pq.Empty())
+	assert.Zero(t, pq.Len())
+
+	pq.Push(4)
+	pq.Push(2)
+	pq.Push(5)
+	pq.Push(1)
+	pq.Push(3)
+
+	assert.Equal(t, 5, pq.Len())
+	assert.EqualValues(t, 5, popValue[int](t, pq))
+
+	pq.Push(3)
+
+	assert.EqualValues(t, 4, popValue[int](t, pq))
+	assert.EqualValues(t, 3, popValue[int](t, pq))
+	assert.EqualValues(t, 3, popValue[int](t, pq))
+
+	pq.Push(5)
+
+	assert.EqualValues(t, 5, popValue[int](t, pq))
+
+	assert.EqualValues(t, 2, popValue[int](t, pq))
+	assert.EqualValues(t, 1, popValue[int](t, pq))
+
+	assert.Zero(t, pq.Len())
+	val, err := pq.Pop()
+	assert.Equal(t, ErrEmpty, err)
+	assert.Zero(t, val)
+}
+
+func TestPriorityQueueItems(t *testing.T) {
+	type job struct {
+		name     string
+		priority int
+	}
+	pq := NewPriorityQueue(func(a, b job) bool {
+		return a.priority > b.priority
+	})
+
+	a := pq.PushItem(job{`a`, 1})
+	b := pq.PushItem(job{`b`, 2})
+	c := pq.PushItem(job{`c`, 3})
+	pq.Push(job{`d`, 4})
+	assert.Equal(t, 4, pq.Len())
+	assert.True(t, pq.Contains(a))
+	assert.True(t, pq.Contains(b))
+	assert.True(t, pq.Contains(c))
+
+	a.Value.priority = 5
+	assert.True(t, pq.Update(a))
+	assert.True(t, pq.Remove(c))
+	assert.False(t, pq.Contains(c))
+	assert.False(t, pq.Remove(c))
+	assert.False(t, pq.Update(c))
+	assert.Equal(t, 3, pq.Len())
+
+	val, err := pq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, `a`, val.name)
+	assert.False(t, pq.Contains(a))
+
+	b.Value.priority = 0
+	assert.True(t, pq.Update(b))
+	assert.Equal(t, `d`, popValue[job](t, pq).name)
+	assert.Equal(t, `b`, popValue[job](t, pq).name)
+	assert.False(t, pq.Contains(b))
+	assert.True(t, pq.Empty())
+
+	other := NewPriorityQueue(func(a, b job) bool {
+		return a.priority > b.priority
+	})
+	other.PushItem(job{`e`, 1})
+	pq.PushItem(job{`f`, 1})
+	assert.False(t, pq.Contains(nil))
+	assert.False(t, other.Contains(pq.PushItem(job{`g`, 1})))
+}
+
+func TestPriorityQueuePeekSnapshot(t *testing.T) {
+	pq := NewPriorityQueue(func(a, b int) bool { return a > b })
+
+	_, err := pq.Peek()
+	assert.Equal(t, ErrEmpty, err)
+	assert.Empty(t, pq.Snapshot())
+
+	for _, i := range []int{3, 1, 4, 1, 5, 9, 2, 6} {
+		pq.Push(i)
+	}
+	item := pq.PushItem(5)
+	val, err := pq.Peek()
+	assert.Nil(t, err)
+	assert.Equal(t, 9, val)
+
+	assert.Equal(t, []int{9, 6, 5, 5, 4, 3, 2, 1, 1}, pq.Snapshot())
+	assert.Equal(t, 9, pq.Len())
+	assert.True(t, pq.Contains(item))
+
+	it := pq.Iterator()
+	pq.Pop()
+	assertIterator(t, it, 9, 6, 5, 5, 4, 3, 2, 1, 1)
+	assert.True(t, pq.Remove(item))
+	assert.Equal(t, []int{6, 5, 4, 3, 2, 1, 1}, pq.Snapshot())
+}
+
+func TestStablePriorityQueue(t *testing.T) {
+	type job struct {
+		name     string
+		priority int
+	}
+	pq := NewStablePriorityQueue(func(a, b job) bool {
+		return a.priority > b.priority
+	})
+
+	for i := 0; i < 20; i++ {
+		pq.Push(job{strconv.Itoa(i), i % 2})
+	}
+	a := pq.PushItem(job{`a`, 0})
+	pq.Push(job{`b`, 0})
+	a.Value.priority = 1
+	pq.Update(a)
+
+	for i := 1; i < 20; i += 2 {
+		assert.Equal(t, strconv.Itoa(i), popValue[job](t, pq).name)
+	}
+	assert.Equal(t, `a`, popValue[job](t, pq).name)
+	for i := 0; i < 20; i += 2 {
+		assert.Equal(t, strconv.Itoa(i), popValue[job](t, pq).name)
+	}
+	assert.Equal(t, `b`, popValue[job](t, pq).name)
+	assert.True(t, pq.Empty())
+}
+
+func BenchmarkPriorityQueuePushIncremental(b *testing.B) {
+	numItems := 1000000
+
+	pqs := make([]*PriorityQueue[int], 0, b.N)
+
+	for i := 0; i < b.N; i++ {
+		pq := NewPriorityQueue(func(a, b int) bool {
+			return a > b
+		})
+		pqs = append(pqs, pq)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pq := pqs[i]
+		for j := 0; j < numItems; j++ {
+			pq.Push(j)
+		}
+	}
+}
+
+func BenchmarkPriorityQueuePopIncremental(b *testing.B) {
+	numItems := 1000000
+
+	pqs := make([]*PriorityQueue[int], 0, b.N)
+
+	for i := 0; i < b.N; i++ {
+		pq := NewPriorityQueue(func(a, b int) bool {
+			return a > b
+		})
+		pqs = append(pqs, pq)
+	}
+
+	for i := 0; i < b.N; i++ {
+		pq := pqs[i]
+		for j := 0; j < numItems; j++ {
+			pq.Push(j)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pq := pqs[i]
+		for j := 0; j < numItems; j++ {
+			pq.Pop()
+		}
+	}
+}
+
+func BenchmarkPriorityQueuePushRandom(b *testing.B) {
+	numItems := 1000000
+
+	pqs := make([]*PriorityQueue[int], 0, b.N)
+
+	for i := 0; i < b.N; i++ {
+		pq := NewPriorityQueue(func(a, b int) bool {
+			return a > b
+		})
+		pqs = append(pqs, pq)
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pq := pqs[i]
+		for j := 0; j < numItems; j++ {
+			pq.Push(r.Intn(numItems))
+		}
+	}
+}
+
+func BenchmarkPriorityQueuePopRandom(b *testing.B) {
+	numItems := 1000000
+
+	pqs := make([]*PriorityQueue[int], 0, b.N)
+
+	for i := 0; i < b.N; i++ {
+		pq := NewPriorityQueue(func(a, b int) bool {
+			return a > b
+		})
+		pqs = append(pqs, pq)
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
+	for i := 0; i < b.N; i++ {
+		pq := pqs[i]
+		for j := 0; j < numItems; j++ {
+			pq.Push(r.Intn(numItems))
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pq := pqs[i]
+		for j := 0; j < numItems; j++ {
+			pq.Pop()
+		}
+	}
+}
+
+func TestPriorityQueueSizeHint(t *testing.T) {
+	pq := NewPriorityQueue(func(a, b int) bool { return a < b }, 16)
+	pq.Push(2)
+	pq.Push(1)
+	assert.Equal(t, []int{1, 2}, pq.Snapshot())
+
+	stable := NewStablePriorityQueue(func(a, b pjob) bool {
+		return a.priority > b.priority
+	}, 16)
+	stable.Push(pjob{"a", 1})
+	stable.Push(pjob{"b", 1})
+	stable.Push(pjob{"c", 2})
+	assert.Equal(t, []pjob{{"c", 2}, {"a", 1}, {"b", 1}}, stable.Snapshot())
+}
+
+var heapBackends = []HeapBackend{BinaryHeap, QuaternaryHeap, PairingHeap}
+
+type pjob struct {
+	name     string
+	priority int
+}
+
+func newJobQueue(backend HeapBackend) *PriorityQueue[pjob] {
+	return NewPriorityQueueWithOptions(func(a, b pjob) bool {
+		return a.priority > b.priority
+	}, PriorityQueueOptions{Backend: backend, Stable: true})
+}
+
+// popJobNames pops all jobs from the queue, and joins their names.
+func popJobNames(t *testing.T, pq *PriorityQueue[pjob]) string {
+	var names []string
+	for !pq.Empty() {
+		names = append(names, popValue[pjob](t, pq).name)
+	}
+	return strings.Join(names, "")
+}
+
+func TestPriorityQueueBackends(t *testing.T) {
+	for _, backend := range heapBackends {
+		pq := newJobQueue(backend)
+
+		handles := make(map[string]*Item[pjob])
+		for i, name := range []string{`a`, `b`, `c`, `d`, `e`, `f`} {
+			handles[name] = pq.PushItem(pjob{name, i % 3})
+		}
+		pq.Push(pjob{`g`, 1})
+
+		handles[`a`].Value.priority = 3
+		assert.True(t, pq.Update(handles[`a`]))
+		handles[`f`].Value.priority = 0
+		assert.True(t, pq.Update(handles[`f`]))
+		assert.True(t, pq.Remove(handles[`b`]))
+		assert.False(t, pq.Contains(handles[`b`]))
+		assert.False(t, pq.Remove(handles[`b`]))
+		assert.Equal(t, 6, pq.Len())
+
+		val, err := pq.Peek()
+		assert.Nil(t, err)
+		assert.Equal(t, `a`, val.name)
+		snapshot := pq.Snapshot()
+		assert.Equal(t, 6, len(snapshot))
+		assert.Equal(t, `c`, snapshot[1].name)
+
+		assert.Equal(t, `acegdf`, popJobNames(t, pq), "backend %d", backend)
+		for _, handle := range handles {
+			assert.False(t, pq.Contains(handle))
+		}
+		_, err = pq.Pop()
+		assert.Equal(t, ErrEmpty, err)
+	}
+}
+
+func TestPriorityQueueBackendsRandom(t *testing.T) {
+	for _, backend := range heapBackends {
+		pq := NewPriorityQueueWithOptions(func(a, b int) bool { return a < b }, PriorityQueueOptions{Backend: backend})
+		var handles []*Item[int]
+		var sorted []int
+
+		r := rand.New(rand.NewSource(4))
+		for i := 0; i < 3000; i++ {
+			switch op := r.Intn(5); {
+			case op < 2 || len(sorted) == 0:
+				val := r.Intn(1000)
+				handles = append(handles, pq.PushItem(val))
+				sorted = append(sorted, val)
+				sort.Ints(sorted)
+			case op == 2:
+				val, err := pq.Pop()
+				assert.Nil(t, err)
+				assert.Equal(t, sorted[0], val)
+				sorted = sorted[1:]
+			default:
+				// change or remove a random item that is still queued
+				handle := handles[r.Intn(len(handles))]
+				if !pq.Contains(handle) {
+					continue
+				}
+				j := sort.SearchInts(sorted, handle.Value)
+				sorted = append(sorted[:j], sorted[j+1:]...)
+				if op == 3 {
+					assert.True(t, pq.Remove(handle))
+					break
+				}
+				handle.Value = r.Intn(1000)
+				assert.True(t, pq.Update(handle))
+				sorted = append(sorted, handle.Value)
+				sort.Ints(sorted)
+			}
+			assert.Equal(t, len(sorted), pq.Len())
+		}
+		assert.Equal(t, sorted, pq.Snapshot())
+	}
+}
+
+func TestPriorityQueueMerge(t *testing.T) {
+	for _, backend := range heapBackends {
+		for _, otherBackend := range heapBackends {
+			pq := newJobQueue(backend)
+			other := newJobQueue(otherBackend)
+
+			pq.Push(pjob{`a`, 1})
+			pq.Push(pjob{`b`, 3})
+			handle := other.PushItem(pjob{`c`, 2})
+			other.Push(pjob{`d`, 0})
+			other.Push(pjob{`e`, 0})
+			pq.Merge(other)
+			pq.Merge(pq)
+
+			assert.Equal(t, 5, pq.Len())
+			assert.True(t, other.Empty())
+			assert.True(t, pq.Contains(handle))
+			assert.False(t, other.Contains(handle))
+
+			// the handle of a moved item refers to the queue it was moved to
+			handle.Value.priority = 4
+			assert.True(t, pq.Update(handle))
+			assert.False(t, other.Update(handle))
+
+			// the other queue is still usable, and later pushes stay stable
+			other.Push(pjob{`f`, 1})
+			pq.Push(pjob{`g`, 0})
+			assert.Equal(t, `cbadeg`, popJobNames(t, pq))
+			assert.Equal(t, `f`, popJobNames(t, other))
+		}
+	}
+}
+
+func BenchmarkPriorityQueueBackends(b *testing.B) {
+	const numItems = 100000
+	r := rand.New(rand.NewSource(1))
+	vals := make([]int, numItems)
+	for i := range vals {
+		vals[i] = r.Intn(numItems)
+	}
+	names := map[HeapBackend]string{BinaryHeap: "Binary", QuaternaryHeap: "Quaternary", PairingHeap: "Pairing"}
+
+	for _, backend := range heapBackends {
+		newQueue := func() *PriorityQueue[int] {
+			return NewPriorityQueueWithOptions(func(a, b int) bool { return a < b }, PriorityQueueOptions{Backend: backend})
+		}
+
+		b.Run(names[backend]+"/Push", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				pq := newQueue()
+				for _, val := range vals {
+					pq.Push(val)
+				}
+			}
+		})
+
+		b.Run(names[backend]+"/PushPop", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				pq := newQueue()
+				for _, val := range vals {
+					pq.Push(val)
+				}
+				b.StartTimer()
+				for !pq.Empty() {
+					pq.Pop()
+				}
+			}
+		})
+
+		// like a timer heap: a steady size, with pushes later than the pops
+		b.Run(names[backend]+"/Steady", func(b *testing.B) {
+			pq := newQueue()
+			for _, val := range vals {
+				pq.Push(val)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				val, _ := pq.Pop()
+				pq.Push(val + vals[i%numItems])
+			}
+		})
+
+		b.Run(names[backend]+"/Merge", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				pq, other := newQueue(), newQueue()
+				for j, val := range vals {
+					if j%2 == 0 {
+						pq.Push(val)
+					} else {
+						other.Push(val)
+					}
+				}
+				b.StartTimer()
+				pq.Merge(other)
+			}
+		})
+	}
+}
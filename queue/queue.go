@@ -1,36 +1,86 @@
-package queue
-
-import (
-	"container/list"
-)
-
-type Queue struct {
-	list *list.List
-}
-
-func NewQueue() *Queue {
-	return &Queue{
-		list: list.New(),
-	}
-}
-
-func (q *Queue) Push(item interface{}) {
-	q.list.PushBack(item)
-}
-
-func (q *Queue) Pop() interface{} {
-	e := q.list.Front()
-	if e == nil {
-		return nil
-	}
-
-	return q.list.Remove(e)
-}
-
-func (q *Queue) Len() int {
-	return q.list.Len()
-}
-
-func (q *Queue) Empty() bool {
-	return q.list.Len() == 0
-}
+package queue
+
+import (
+	"time"
+
+	"github.com/ridewindx/crumb/functional"
+)
+
+// Interface is implemented by every queue in this package, so that callers
+// can swap one implementation for another without rewriting call sites.
+//
+// The timeout follows the convention of ChannelQueue and RingQueue: with no
+// timeout a blocking queue waits until the operation can proceed, a nonzero
+// timeout bounds the wait and yields ErrTimeout, and a zero timeout never
+// waits and yields ErrFull or ErrEmpty. Queues that never block ignore the
+// timeout.
+type Interface[T any] interface {
+	Push(item T, timeout ...time.Duration) error
+	Pop(timeout ...time.Duration) (T, error)
+	Len() int
+	Empty() bool
+}
+
+var (
+	_ Interface[int] = (*Queue[int])(nil)
+	_ Interface[int] = (*ChannelQueue[int])(nil)
+	_ Interface[int] = (*PriorityQueue[int])(nil)
+	_ Interface[int] = (*RingQueue[int])(nil)
+	_ Interface[int] = (*BlockingPriorityQueue[int])(nil)
+	_ Interface[int] = (*LinkedQueue[int])(nil)
+	_ Interface[int] = (*SPSCRingQueue[int])(nil)
+	_ Interface[int] = (*DiskQueue[int])(nil)
+	_ Interface[int] = (*DedupQueue[int, int])(nil)
+	_ Interface[int] = (*BoundedPriorityQueue[int])(nil)
+	_ Interface[int] = (*MinMaxHeap[int])(nil)
+	_ Interface[int] = (*AgingPriorityQueue[int])(nil)
+)
+
+// Queue is an unbounded FIFO queue. It is not safe for concurrent use.
+type Queue[T any] struct {
+	deque Deque[T]
+}
+
+func NewQueue[T any]() *Queue[T] {
+	return &Queue[T]{}
+}
+
+// Push adds the item to the back of the queue. It never fails.
+func (q *Queue[T]) Push(item T, timeout ...time.Duration) error {
+	q.deque.PushBack(item)
+	return nil
+}
+
+// Pop removes and returns the item at the front of the queue,
+// or returns ErrEmpty if the queue is empty.
+func (q *Queue[T]) Pop(timeout ...time.Duration) (T, error) {
+	return q.deque.PopFront()
+}
+
+// Peek returns the item at the front of the queue without removing it,
+// or returns ErrEmpty if the queue is empty.
+func (q *Queue[T]) Peek() (T, error) {
+	return q.deque.PeekFront()
+}
+
+// Snapshot returns a copy of the items in the queue, from front to back.
+func (q *Queue[T]) Snapshot() []T {
+	items := make([]T, q.deque.Len())
+	for i := range items {
+		items[i] = q.deque.At(i)
+	}
+	return items
+}
+
+// Iterator returns an iterator over a Snapshot of the queue.
+func (q *Queue[T]) Iterator() functional.Iterator {
+	return newSnapshotIterator(q.Snapshot())
+}
+
+func (q *Queue[T]) Len() int {
+	return q.deque.Len()
+}
+
+func (q *Queue[T]) Empty() bool {
+	return q.deque.Empty()
+}
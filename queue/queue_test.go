@@ -1,82 +1,155 @@
-package queue
-
-import (
-	"testing"
-	"github.com/stretchr/testify/assert"
-)
-
-func TestQueuePushPop(t *testing.T) {
-	pq := NewQueue()
-
-	assert.True(t, pq.Empty())
-	assert.Zero(t, pq.Len())
-
-	pq.Push(1)
-	pq.Push(2)
-	pq.Push(3)
-	pq.Push(4)
-	pq.Push(5)
-
-	assert.Equal(t, 5, pq.Len())
-	assert.EqualValues(t, 1, pq.Pop())
-
-	pq.Push(6)
-
-	assert.EqualValues(t, 2, pq.Pop())
-	assert.EqualValues(t, 3, pq.Pop())
-	assert.EqualValues(t, 4, pq.Pop())
-
-	pq.Push(7)
-
-	assert.EqualValues(t, 5, pq.Pop())
-	assert.EqualValues(t, 6, pq.Pop())
-	assert.EqualValues(t, 7, pq.Pop())
-
-	assert.Zero(t, pq.Len())
-	assert.Nil(t, pq.Pop())
-}
-
-func BenchmarkQueuePushIncremental(b *testing.B) {
-	numItems := 1000000
-
-	pqs := make([]*Queue, 0, b.N)
-
-	for i := 0; i < b.N; i++ {
-		pq := NewQueue()
-		pqs = append(pqs, pq)
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		pq := pqs[i]
-		for j := 0; j < numItems; j++ {
-			pq.Push(j)
-		}
-	}
-}
-
-func BenchmarkQueuePopIncremental(b *testing.B) {
-	numItems := 1000000
-
-	pqs := make([]*Queue, 0, b.N)
-
-	for i := 0; i < b.N; i++ {
-		pq := NewQueue()
-		pqs = append(pqs, pq)
-	}
-
-	for i := 0; i < b.N; i++ {
-		pq := pqs[i]
-		for j := 0; j < numItems; j++ {
-			pq.Push(j)
-		}
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		pq := pqs[i]
-		for j := 0; j < numItems; j++ {
-			pq.Pop()
-		}
-	}
-}
+package queue
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/ridewindx/crumb/functional"
+)
+
+func TestQueuePushPop(t *testing.T) {
+	pq := NewQueue[int]()
+
+	assert.True(t, pq.Empty())
+	assert.Zero(t, pq.Len())
+
+	pq.Push(1)
+	pq.Push(2)
+	pq.Push(3)
+	pq.Push(4)
+	pq.Push(5)
+
+	assert.Equal(t, 5, pq.Len())
+	assert.EqualValues(t, 1, popValue[int](t, pq))
+
+	pq.Push(6)
+
+	assert.EqualValues(t, 2, popValue[int](t, pq))
+	assert.EqualValues(t, 3, popValue[int](t, pq))
+	assert.EqualValues(t, 4, popValue[int](t, pq))
+
+	pq.Push(7)
+
+	assert.EqualValues(t, 5, popValue[int](t, pq))
+	assert.EqualValues(t, 6, popValue[int](t, pq))
+	assert.EqualValues(t, 7, popValue[int](t, pq))
+
+	assert.Zero(t, pq.Len())
+	val, err := pq.Pop()
+	assert.Equal(t, ErrEmpty, err)
+	assert.Zero(t, val)
+}
+
+func TestQueuePeekSnapshot(t *testing.T) {
+	q := NewQueue[int]()
+
+	_, err := q.Peek()
+	assert.Equal(t, ErrEmpty, err)
+	assert.Empty(t, q.Snapshot())
+
+	for i := 1; i <= 3; i++ {
+		q.Push(i)
+	}
+	val, err := q.Peek()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	assert.Equal(t, 3, q.Len())
+
+	it := q.Iterator()
+	q.Pop()
+	assert.Equal(t, []int{2, 3}, q.Snapshot())
+	assertIterator(t, it, 1, 2, 3)
+}
+
+// assertIterator asserts that it returns the items, then ErrEmpty.
+func assertIterator[T any](t *testing.T, it functional.Iterator, items ...T) {
+	for _, item := range items {
+		assert.True(t, it.HasNext())
+		val, err := it.Next()
+		assert.Nil(t, err)
+		assert.Equal(t, item, val)
+	}
+	assert.False(t, it.HasNext())
+	_, err := it.Next()
+	assert.Equal(t, ErrEmpty, err)
+}
+
+func TestQueueInterface(t *testing.T) {
+	queues := map[string]Interface[int]{
+		"Queue":                 NewQueue[int](),
+		"ChannelQueue":          NewChannelQueue[int](8),
+		"PriorityQueue":         NewPriorityQueue(func(a, b int) bool { return a < b }),
+		"RingQueue":             NewRingQueue[int](8, BlockingWait{}),
+		"BlockingPriorityQueue": NewBlockingPriorityQueue(func(a, b int) bool { return a < b }),
+		"LinkedQueue":           NewLinkedQueue[int](BlockingWait{}),
+		"SPSCRingQueue":         NewSPSCRingQueue[int](8, BlockingWait{}),
+	}
+
+	for name, q := range queues {
+		assert.True(t, q.Empty(), name)
+
+		for i := 1; i <= 3; i++ {
+			assert.Nil(t, q.Push(i), name)
+		}
+		assert.Equal(t, 3, q.Len(), name)
+
+		for i := 1; i <= 3; i++ {
+			assert.Equal(t, i, popValue(t, q), name)
+		}
+		assert.True(t, q.Empty(), name)
+
+		_, err := q.Pop(0)
+		assert.Equal(t, ErrEmpty, err, name)
+	}
+}
+
+// popValue pops an item from q, asserting that the pop succeeds.
+func popValue[T any](t *testing.T, q Interface[T]) T {
+	val, err := q.Pop()
+	assert.Nil(t, err)
+	return val
+}
+
+func BenchmarkQueuePushIncremental(b *testing.B) {
+	numItems := 1000000
+
+	pqs := make([]*Queue[int], 0, b.N)
+
+	for i := 0; i < b.N; i++ {
+		pq := NewQueue[int]()
+		pqs = append(pqs, pq)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pq := pqs[i]
+		for j := 0; j < numItems; j++ {
+			pq.Push(j)
+		}
+	}
+}
+
+func BenchmarkQueuePopIncremental(b *testing.B) {
+	numItems := 1000000
+
+	pqs := make([]*Queue[int], 0, b.N)
+
+	for i := 0; i < b.N; i++ {
+		pq := NewQueue[int]()
+		pqs = append(pqs, pq)
+	}
+
+	for i := 0; i < b.N; i++ {
+		pq := pqs[i]
+		for j := 0; j < numItems; j++ {
+			pq.Push(j)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pq := pqs[i]
+		for j := 0; j < numItems; j++ {
+			pq.Pop()
+		}
+	}
+}
@@ -1,205 +1,383 @@
-package queue
-
-import (
-	"runtime"
-	"sync/atomic"
-	"time"
-)
-
-// RingQueue is a bounded MPMC ring buffer queue that achieves concurrency
-// with CAS operations only.
-type RingQueue struct {
-	padding0       [8]uint64
-	tail           uint64
-	padding1       [8]uint64
-	head           uint64
-	padding2       [8]uint64
-	mask uint64
-	padding3       [8]uint64
-	nodes          []*ringnode
-	spin bool
-	notFull        chan struct{}
-	notEmpty       chan struct{}
-}
-
-type ringnode struct {
-	position uint64
-	data     interface{}
-}
-
-// NewRingQueue will allocate a RingQueue with the specified capacity.
-// The `spin` specifies the waiting strategy when operation will be blocked:
-// if true, spin on CAS; otherwise, wait on channel for notification.
-func NewRingQueue(capacity int, spin bool) *RingQueue {
-	if capacity == 0 {
-		panic("RingQueue capacity must be greater than 0")
-	}
-	n := roundUp(uint64(capacity))
-
-	rb := &RingQueue{
-		nodes: make([]*ringnode, n),
-		mask: n-1,
-		spin: spin,
-		notFull: make(chan struct{}, 1),
-		notEmpty: make(chan struct{}, 1),
-	}
-	for i := uint64(0); i < n; i++ {
-		rb.nodes[i] = &ringnode{position: i}
-	}
-	return rb
-}
-
-// Push adds the item to the queue. If the queue is full, will block
-// until an item is added to the queue. If a nonzero timeout is specified,
-// block no more than the timeout duration and return ErrTimeout. If timeout
-// is zero, immediately return ErrFull.
-func (rq *RingQueue) Push(item interface{}, timeout ...time.Duration) error {
-	var n *ringnode
-	var pos uint64
-	var tic time.Time
-	if len(timeout) > 0 && timeout[0] > 0 {
-		tic = time.Now()
-	}
-	i := 0
-	for {
-		pos = atomic.LoadUint64(&rq.tail)
-		n = rq.nodes[pos&rq.mask]
-		seq := atomic.LoadUint64(&n.position)
-		if seq == pos {
-			if atomic.CompareAndSwapUint64(&rq.tail, pos, pos+1) {
-				n.data = item
-				atomic.StoreUint64(&n.position, pos+1)
-				//rq.print()
-				if !rq.spin {
-					select {
-					case rq.notEmpty <- struct{}{}:
-					default:
-					}
-				}
-				return nil
-			}
-		} else if seq < pos { // queue is full
-			if len(timeout) == 0 {
-				if !rq.spin {
-					<-rq.notFull // wait for a pop
-				}
-			} else if timeout[0] > 0 {
-				if !rq.spin {
-					select { // wait for a pop, until timeout
-					case <-rq.notFull:
-					case <-time.After(timeout[0]):
-						return ErrTimeout
-					}
-				} else if time.Now().Sub(tic) >= timeout[0] {
-					return ErrTimeout
-				}
-			} else {
-				return ErrFull
-			}
-		} else { // another push occurred
-		}
-
-		if i == 10000 {
-			runtime.Gosched() // free up the cpu before the next iteration
-			i = 0
-		} else {
-			i++
-		}
-	}
-}
-
-// Push will return the next item in the queue. If the queue is empty,
-// block until an item can be returned. If a nonzero timeout is specified,
-// block no more than the timeout duration and return ErrTimeout. If timeout
-// is zero, immediately return ErrEmpty.
-func (rq *RingQueue) Pop(timeout ...time.Duration) (interface{}, error) {
-	var n *ringnode
-	pos := atomic.LoadUint64(&rq.head)
-	var tic time.Time
-	if len(timeout) > 0 && timeout[0] > 0 {
-		tic = time.Now()
-	}
-	i := 0
-	for {
-		pos = atomic.LoadUint64(&rq.head)
-		n = rq.nodes[pos&rq.mask]
-		seq := atomic.LoadUint64(&n.position)
-		if seq == pos+1 {
-			if atomic.CompareAndSwapUint64(&rq.head, pos, pos+1) {
-				data := n.data
-				n.data = nil
-				atomic.StoreUint64(&n.position, pos+rq.mask+1)
-				//rq.print()
-				if !rq.spin {
-					select {
-					case rq.notFull <- struct{}{}:
-					default:
-					}
-				}
-				return data, nil
-			}
-
-		} else if seq < pos+1 { // queue is empty
-			if len(timeout) == 0 {
-				if !rq.spin {
-					<-rq.notEmpty // wait for a push
-				}
-			} else if timeout[0] > 0 {
-				if !rq.spin {
-					select { // wait for a push, until timeout
-					case <-rq.notEmpty:
-					case <-time.After(timeout[0]):
-						return nil, ErrTimeout
-					}
-				} else if time.Now().Sub(tic) >= timeout[0] {
-					return nil, ErrTimeout
-				}
-			} else {
-				return nil, ErrEmpty
-			}
-		} else { // another pop occurred
-		}
-
-		if i == 10000 {
-			runtime.Gosched() // free up the cpu before the next iteration
-			i = 0
-		} else {
-			i++
-		}
-	}
-}
-
-// Len returns the number of items in the queue.
-func (rq *RingQueue) Len() int {
-	return int(atomic.LoadUint64(&rq.tail) - atomic.LoadUint64(&rq.head))
-}
-
-// Empty returns whether the queue is empty.
-func (rq *RingQueue) Empty() bool {
-	return atomic.LoadUint64(&rq.tail) == atomic.LoadUint64(&rq.head)
-}
-
-// roundUp rounds the uint64 v (v > 0) up to the next
-// power of 2.
-func roundUp(v uint64) uint64 {
-	v--
-	v |= v >> 1
-	v |= v >> 2
-	v |= v >> 4
-	v |= v >> 8
-	v |= v >> 16
-	v |= v >> 32
-	v++
-	return v
-}
-
-/*
-func (rq *RingQueue) print() {
-	fmt.Printf("queue %d, dequeue %d\n", rq.tail, rq.head)
-	fmt.Print("nodes: ")
-	for i := uint64(0); i <= rq.mask; i++ {
-		fmt.Printf("%d(%v) ", rq.nodes[i].position, rq.nodes[i].data)
-	}
-	fmt.Println()
-}
-*/
+package queue
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ridewindx/crumb/functional"
+)
+
+// RingQueue is a bounded MPMC ring buffer queue that achieves concurrency
+// with CAS operations only.
+type RingQueue[T any] struct {
+	padding0 [8]uint64
+	tail     uint64
+	padding1 [8]uint64
+	head     uint64
+	padding2 [8]uint64
+	mask     uint64
+	padding3 [8]uint64
+	nodes    []*ringnode[T]
+	strategy WaitStrategy
+	signal   bool
+	notFull  chan struct{}
+	notEmpty chan struct{}
+	done     chan struct{}
+	closer   sync.Once
+}
+
+type ringnode[T any] struct {
+	position uint64
+	data     T
+}
+
+// NewRingQueue will allocate a RingQueue with the specified capacity.
+// The `strategy` specifies how an operation waits when it will be blocked,
+// e.g. BusySpinWait to spin on CAS, or BlockingWait to wait for notification.
+func NewRingQueue[T any](capacity int, strategy WaitStrategy) *RingQueue[T] {
+	if capacity == 0 {
+		panic("RingQueue capacity must be greater than 0")
+	}
+	n := roundUp(uint64(capacity))
+
+	rb := &RingQueue[T]{
+		nodes:    make([]*ringnode[T], n),
+		mask:     n - 1,
+		strategy: strategy,
+		signal:   strategy.Parks(),
+		notFull:  make(chan struct{}, 1),
+		notEmpty: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	for i := uint64(0); i < n; i++ {
+		rb.nodes[i] = &ringnode[T]{position: i}
+	}
+	return rb
+}
+
+// Push adds the item to the queue. If the queue is full, will block
+// until an item is added to the queue. If a nonzero timeout is specified,
+// block no more than the timeout duration and return ErrTimeout. If timeout
+// is zero, immediately return ErrFull. If the queue is closed, return ErrClosed.
+func (rq *RingQueue[T]) Push(item T, timeout ...time.Duration) error {
+	return rq.push(context.Background(), item, timeout...)
+}
+
+// PushContext adds the item to the queue. If the queue is full, will block
+// until an item is added to the queue or ctx is done, in which case
+// ctx.Err() is returned. If the queue is closed, return ErrClosed.
+func (rq *RingQueue[T]) PushContext(ctx context.Context, item T) error {
+	return rq.push(ctx, item)
+}
+
+func (rq *RingQueue[T]) push(ctx context.Context, item T, timeout ...time.Duration) error {
+	var n *ringnode[T]
+	var pos uint64
+	w := newWaiter(ctx, timeout)
+	if rq.IsClosed() {
+		return ErrClosed
+	}
+	for {
+		pos = atomic.LoadUint64(&rq.tail)
+		n = rq.nodes[pos&rq.mask]
+		seq := atomic.LoadUint64(&n.position)
+		if seq == pos {
+			if atomic.CompareAndSwapUint64(&rq.tail, pos, pos+1) {
+				n.data = item
+				atomic.StoreUint64(&n.position, pos+1)
+				//rq.print()
+				rq.notify(rq.notEmpty)
+				if w.attempt > 0 && rq.Len() <= int(rq.mask) {
+					rq.notify(rq.notFull) // pass the wakeup on to the next blocked push
+				}
+				return nil
+			}
+			w.retry(rq.strategy, rq.done)
+		} else if seq < pos { // queue is full
+			if rq.IsClosed() {
+				return ErrClosed
+			}
+			if err := w.wait(rq.strategy, rq.notFull, rq.done, ErrFull); err != nil {
+				return err
+			}
+		} else { // another push occurred
+			w.retry(rq.strategy, rq.done)
+		}
+	}
+}
+
+// PushBatch adds the items to the queue in order. Each round reserves as many
+// free slots as are available, up to the remaining items, with a single CAS.
+// If the queue is full, will block until an item is removed from the queue.
+// It returns the number of items added; if that is less than len(items), the
+// error follows the same timeout rules as Push and reports why.
+func (rq *RingQueue[T]) PushBatch(items []T, timeout ...time.Duration) (int, error) {
+	var pos uint64
+	w := newWaiter(context.Background(), timeout)
+	pushed := 0
+	for pushed < len(items) {
+		if rq.IsClosed() {
+			return pushed, ErrClosed
+		}
+		pos = atomic.LoadUint64(&rq.tail)
+		free := uint64(0)
+		for free < uint64(len(items)-pushed) && atomic.LoadUint64(&rq.nodes[(pos+free)&rq.mask].position) == pos+free {
+			free++
+		}
+		if free > 0 {
+			if atomic.CompareAndSwapUint64(&rq.tail, pos, pos+free) {
+				for k := uint64(0); k < free; k++ {
+					n := rq.nodes[(pos+k)&rq.mask]
+					n.data = items[pushed]
+					atomic.StoreUint64(&n.position, pos+k+1)
+					pushed++
+				}
+				rq.notify(rq.notEmpty)
+				if w.attempt > 0 && rq.Len() <= int(rq.mask) {
+					rq.notify(rq.notFull) // pass the wakeup on to the next blocked push
+				}
+				continue
+			}
+			w.retry(rq.strategy, rq.done)
+		} else if atomic.LoadUint64(&rq.nodes[pos&rq.mask].position) < pos { // queue is full
+			if err := w.wait(rq.strategy, rq.notFull, rq.done, ErrFull); err != nil {
+				return pushed, err
+			}
+		} else { // another push occurred
+			w.retry(rq.strategy, rq.done)
+		}
+	}
+	return pushed, nil
+}
+
+// Pop will return the next item in the queue. If the queue is empty,
+// block until an item can be returned. If a nonzero timeout is specified,
+// block no more than the timeout duration and return ErrTimeout. If timeout
+// is zero, immediately return ErrEmpty. Once the queue is closed, the
+// remaining items are still returned, after which ErrClosed is returned.
+func (rq *RingQueue[T]) Pop(timeout ...time.Duration) (T, error) {
+	return rq.pop(context.Background(), timeout...)
+}
+
+// PopContext will return the next item in the queue. If the queue is empty,
+// block until an item can be returned or ctx is done, in which case
+// ctx.Err() is returned. Once the queue is closed, the remaining items
+// are still returned, after which ErrClosed is returned.
+func (rq *RingQueue[T]) PopContext(ctx context.Context) (T, error) {
+	return rq.pop(ctx)
+}
+
+func (rq *RingQueue[T]) pop(ctx context.Context, timeout ...time.Duration) (T, error) {
+	var zero T
+	var n *ringnode[T]
+	var pos uint64
+	w := newWaiter(ctx, timeout)
+	for {
+		pos = atomic.LoadUint64(&rq.head)
+		if pos&readMark != 0 { // Peek or Snapshot is reading the items
+			runtime.Gosched()
+			continue
+		}
+		n = rq.nodes[pos&rq.mask]
+		seq := atomic.LoadUint64(&n.position)
+		if seq == pos+1 {
+			if atomic.CompareAndSwapUint64(&rq.head, pos, pos+1) {
+				data := n.data
+				n.data = zero
+				atomic.StoreUint64(&n.position, pos+rq.mask+1)
+				//rq.print()
+				rq.notify(rq.notFull)
+				if w.attempt > 0 && !rq.Empty() {
+					rq.notify(rq.notEmpty) // pass the wakeup on to the next blocked pop
+				}
+				return data, nil
+			}
+			w.retry(rq.strategy, rq.done)
+		} else if seq < pos+1 { // queue is empty
+			if rq.IsClosed() {
+				if atomic.LoadUint64(&rq.tail) == pos {
+					return zero, ErrClosed
+				}
+				// a push is still in flight, retry until it completes
+				w.retry(rq.strategy, rq.done)
+			} else if err := w.wait(rq.strategy, rq.notEmpty, rq.done, ErrEmpty); err != nil {
+				return zero, err
+			}
+		} else { // another pop occurred
+			w.retry(rq.strategy, rq.done)
+		}
+	}
+}
+
+// PopBatch removes up to len(dst) items from the queue into dst, in order,
+// reserving all the available items with a single CAS. If the queue is empty,
+// block until at least one item can be returned, following the same timeout
+// rules as Pop. It returns the number of items removed.
+func (rq *RingQueue[T]) PopBatch(dst []T, timeout ...time.Duration) (int, error) {
+	var zero T
+	var pos uint64
+	w := newWaiter(context.Background(), timeout)
+	if len(dst) == 0 {
+		return 0, nil
+	}
+	for {
+		pos = atomic.LoadUint64(&rq.head)
+		if pos&readMark != 0 { // Peek or Snapshot is reading the items
+			runtime.Gosched()
+			continue
+		}
+		ready := uint64(0)
+		for ready < uint64(len(dst)) && atomic.LoadUint64(&rq.nodes[(pos+ready)&rq.mask].position) == pos+ready+1 {
+			ready++
+		}
+		if ready > 0 {
+			if atomic.CompareAndSwapUint64(&rq.head, pos, pos+ready) {
+				for k := uint64(0); k < ready; k++ {
+					n := rq.nodes[(pos+k)&rq.mask]
+					dst[k] = n.data
+					n.data = zero
+					atomic.StoreUint64(&n.position, pos+k+rq.mask+1)
+				}
+				rq.notify(rq.notFull)
+				if w.attempt > 0 && !rq.Empty() {
+					rq.notify(rq.notEmpty) // pass the wakeup on to the next blocked pop
+				}
+				return int(ready), nil
+			}
+			w.retry(rq.strategy, rq.done)
+		} else if atomic.LoadUint64(&rq.nodes[pos&rq.mask].position) < pos+1 { // queue is empty
+			if rq.IsClosed() {
+				if atomic.LoadUint64(&rq.tail) == pos {
+					return 0, ErrClosed
+				}
+				// a push is still in flight, retry until it completes
+				w.retry(rq.strategy, rq.done)
+			} else if err := w.wait(rq.strategy, rq.notEmpty, rq.done, ErrEmpty); err != nil {
+				return 0, err
+			}
+		} else { // another pop occurred
+			w.retry(rq.strategy, rq.done)
+		}
+	}
+}
+
+// readMark is set in head while Peek or Snapshot reads the items, which
+// holds off pops meanwhile. Pushes go on, as they only touch free nodes.
+const readMark = 1 << 63
+
+// Peek returns the next item in the queue without removing it,
+// or returns ErrEmpty if the queue is empty.
+func (rq *RingQueue[T]) Peek() (T, error) {
+	pos := rq.lockHead()
+	defer atomic.StoreUint64(&rq.head, pos)
+
+	n := rq.nodes[pos&rq.mask]
+	if atomic.LoadUint64(&n.position) != pos+1 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return n.data, nil
+}
+
+// Snapshot returns a copy of the items in the queue, in order.
+// Pops wait while it runs, so it reflects a single instant.
+func (rq *RingQueue[T]) Snapshot() []T {
+	head := rq.lockHead()
+	defer atomic.StoreUint64(&rq.head, head)
+
+	var items []T
+	for pos := head; ; pos++ {
+		n := rq.nodes[pos&rq.mask]
+		if atomic.LoadUint64(&n.position) != pos+1 {
+			break
+		}
+		items = append(items, n.data)
+	}
+	return items
+}
+
+// Iterator returns an iterator over a Snapshot of the queue.
+func (rq *RingQueue[T]) Iterator() functional.Iterator {
+	return newSnapshotIterator(rq.Snapshot())
+}
+
+// lockHead sets readMark in head and returns the head position.
+func (rq *RingQueue[T]) lockHead() uint64 {
+	for {
+		pos := atomic.LoadUint64(&rq.head)
+		if pos&readMark == 0 && atomic.CompareAndSwapUint64(&rq.head, pos, pos|readMark) {
+			return pos
+		}
+		runtime.Gosched()
+	}
+}
+
+// notify wakes up an operation waiting on ch, if any.
+func (rq *RingQueue[T]) notify(ch chan struct{}) {
+	if rq.signal {
+		notify(ch)
+	}
+}
+
+// Close closes the queue and wakes up all blocked producers and consumers.
+// Further pushes return ErrClosed, while pops keep returning the remaining
+// items until the queue is drained. Close is idempotent.
+func (rq *RingQueue[T]) Close() {
+	rq.closer.Do(func() {
+		close(rq.done)
+	})
+}
+
+// IsClosed reports whether the queue has been closed.
+func (rq *RingQueue[T]) IsClosed() bool {
+	return isDone(rq.done)
+}
+
+// Len returns the number of items in the queue.
+func (rq *RingQueue[T]) Len() int {
+	return int(atomic.LoadUint64(&rq.tail) - atomic.LoadUint64(&rq.head)&^readMark)
+}
+
+// Empty returns whether the queue is empty.
+func (rq *RingQueue[T]) Empty() bool {
+	return atomic.LoadUint64(&rq.tail) == atomic.LoadUint64(&rq.head)&^readMark
+}
+
+// isDone reports whether the done channel has been closed without blocking.
+// A nil channel, as returned by context.Background().Done(), is never done.
+func isDone(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// roundUp rounds the uint64 v (v > 0) up to the next
+// power of 2.
+func roundUp(v uint64) uint64 {
+	v--
+	v |= v >> 1
+	v |= v >> 2
+	v |= v >> 4
+	v |= v >> 8
+	v |= v >> 16
+	v |= v >> 32
+	v++
+	return v
+}
+
+/*
+func (rq *RingQueue[T]) print() {
+	fmt.Printf("queue %d, dequeue %d\n", rq.tail, rq.head)
+	fmt.Print("nodes: ")
+	for i := uint64(0); i <= rq.mask; i++ {
+		fmt.Printf("%d(%v) ", rq.nodes[i].position, rq.nodes[i].data)
+	}
+	fmt.Println()
+}
+*/
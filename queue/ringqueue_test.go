@@ -1,383 +1,785 @@
-package queue
-
-import (
-	"testing"
-	"github.com/stretchr/testify/assert"
-	"time"
-	"sync"
-)
-
-func TestRingQueuePushPop(t *testing.T) {
-	rq := NewRingQueue(8, false)
-
-	assert.True(t, rq.Empty())
-	assert.Zero(t, rq.Len())
-
-	err := rq.Push(1)
-	assert.Nil(t, err)
-
-	assert.False(t, rq.Empty())
-	assert.Equal(t, 1, rq.Len())
-
-	val, err := rq.Pop()
-	assert.Nil(t, err)
-	assert.Equal(t, 1, val)
-
-	rq.Push(1)
-	rq.Push(2)
-
-	val, err = rq.Pop()
-	assert.Nil(t, err)
-	assert.Equal(t, 1, val)
-
-	rq.Push(3)
-	rq.Push(4)
-
-	val, err = rq.Pop()
-	assert.Nil(t, err)
-	assert.Equal(t, 2, val)
-
-	val, err = rq.Pop()
-	assert.Nil(t, err)
-	assert.Equal(t, 3, val)
-
-	assert.False(t, rq.Empty())
-	assert.Equal(t, 1, rq.Len())
-}
-
-func TestRingQueueSpinNonblocking(t *testing.T) {
-	rq := NewRingQueue(2, true)
-
-	err := rq.Push(1, 0)
-	assert.Nil(t, err)
-	err = rq.Push(2, 0)
-	assert.Nil(t, err)
-	err = rq.Push(3, 0)
-	assert.Equal(t, ErrFull, err)
-
-	val, err := rq.Pop(0)
-	assert.Nil(t, err)
-	assert.Equal(t, 1, val)
-	val, err = rq.Pop(0)
-	assert.Nil(t, err)
-	assert.Equal(t, 2, val)
-	val, err = rq.Pop(0)
-	assert.Equal(t, ErrEmpty, err)
-	assert.Nil(t, val)
-
-	err = rq.Push(3, 0)
-	assert.Nil(t, err)
-
-	val, err = rq.Pop(0)
-	assert.Nil(t, err)
-	assert.Equal(t, 3, val)
-}
-
-func TestRingQueueSpinTimeout(t *testing.T) {
-	rq := NewRingQueue(2, true)
-
-	err := rq.Push(1)
-	assert.Nil(t, err)
-	err = rq.Push(2)
-	assert.Nil(t, err)
-	err = rq.Push(3, time.Microsecond)
-	assert.Equal(t, ErrTimeout, err)
-
-	val, err := rq.Pop()
-	assert.Nil(t, err)
-	assert.Equal(t, 1, val)
-	val, err = rq.Pop()
-	assert.Nil(t, err)
-	assert.Equal(t, 2, val)
-	val, err = rq.Pop(time.Microsecond)
-	assert.Equal(t, ErrTimeout, err)
-	assert.Nil(t, val)
-
-	go func() {
-		time.Sleep(2*time.Millisecond)
-		err = rq.Push(3)
-		assert.Nil(t, err)
-	}()
-
-	val, err = rq.Pop(time.Millisecond)
-	assert.Equal(t, ErrTimeout, err)
-	assert.Nil(t, val)
-
-	val, err = rq.Pop(5*time.Millisecond)
-	assert.Nil(t, err)
-	assert.Equal(t, 3, val)
-}
-
-func TestRingQueueSpinBlocking(t *testing.T) {
-	rq := NewRingQueue(2, true)
-
-	err := rq.Push(1)
-	assert.Nil(t, err)
-	err = rq.Push(2)
-	assert.Nil(t, err)
-
-	go func() {
-		time.Sleep(2*time.Millisecond)
-		val, err := rq.Pop()
-		assert.Nil(t, err)
-		assert.Equal(t, 1, val)
-	}()
-
-	err = rq.Push(3)
-	assert.Nil(t, err)
-
-	val, err := rq.Pop()
-	assert.Nil(t, err)
-	assert.Equal(t, 2, val)
-
-	go func() {
-		time.Sleep(2*time.Millisecond)
-		err = rq.Push(3)
-		assert.Nil(t, err)
-	}()
-
-	val, err = rq.Pop()
-	assert.Nil(t, err)
-	assert.Equal(t, 3, val)
-}
-
-func TestRingQueueChannelNonblocking(t *testing.T) {
-	rq := NewRingQueue(2, false)
-
-	err := rq.Push(1, 0)
-	assert.Nil(t, err)
-	err = rq.Push(2, 0)
-	assert.Nil(t, err)
-	err = rq.Push(3, 0)
-	assert.Equal(t, ErrFull, err)
-
-	val, err := rq.Pop(0)
-	assert.Nil(t, err)
-	assert.Equal(t, 1, val)
-	val, err = rq.Pop(0)
-	assert.Nil(t, err)
-	assert.Equal(t, 2, val)
-	val, err = rq.Pop(0)
-	assert.Equal(t, ErrEmpty, err)
-	assert.Nil(t, val)
-
-	err = rq.Push(3, 0)
-	assert.Nil(t, err)
-
-	val, err = rq.Pop(0)
-	assert.Nil(t, err)
-	assert.Equal(t, 3, val)
-}
-
-func TestRingQueueChannelTimeout(t *testing.T) {
-	rq := NewRingQueue(2, false)
-
-	err := rq.Push(1)
-	assert.Nil(t, err)
-	err = rq.Push(2)
-	assert.Nil(t, err)
-	err = rq.Push(3, time.Microsecond)
-	assert.Equal(t, ErrTimeout, err)
-
-	val, err := rq.Pop()
-	assert.Nil(t, err)
-	assert.Equal(t, 1, val)
-	val, err = rq.Pop()
-	assert.Nil(t, err)
-	assert.Equal(t, 2, val)
-	val, err = rq.Pop(time.Microsecond)
-	assert.Equal(t, ErrTimeout, err)
-	assert.Nil(t, val)
-
-	go func() {
-		time.Sleep(2*time.Millisecond)
-		err = rq.Push(3)
-		assert.Nil(t, err)
-	}()
-
-	val, err = rq.Pop(time.Millisecond)
-	assert.Equal(t, ErrTimeout, err)
-	assert.Nil(t, val)
-
-	val, err = rq.Pop(5*time.Millisecond)
-	assert.Nil(t, err)
-	assert.Equal(t, 3, val)
-}
-
-func TestRingQueueChannelBlocking(t *testing.T) {
-	rq := NewRingQueue(2, false)
-
-	err := rq.Push(1)
-	assert.Nil(t, err)
-	err = rq.Push(2)
-	assert.Nil(t, err)
-
-	go func() {
-		time.Sleep(2*time.Millisecond)
-		val, err := rq.Pop()
-		assert.Nil(t, err)
-		assert.Equal(t, 1, val)
-	}()
-
-	err = rq.Push(3)
-	assert.Nil(t, err)
-
-	val, err := rq.Pop()
-	assert.Nil(t, err)
-	assert.Equal(t, 2, val)
-
-	go func() {
-		time.Sleep(2*time.Millisecond)
-		err = rq.Push(3)
-		assert.Nil(t, err)
-	}()
-
-	val, err = rq.Pop()
-	assert.Nil(t, err)
-	assert.Equal(t, 3, val)
-}
-
-func BenchmarkRingQueueSpinPushPop(b *testing.B) {
-	rq := NewRingQueue(64, true)
-
-	var count int
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
-		for {
-			_, err := rq.Pop()
-			assert.Nil(b, err)
-
-			count++
-			if count == b.N {
-				return
-			}
-		}
-	}()
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		rq.Push(i)
-	}
-
-	wg.Wait()
-}
-
-func BenchmarkRingQueueSpinPush(b *testing.B) {
-	rq := NewRingQueue(b.N, true)
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		rq.Push(i)
-	}
-}
-
-func BenchmarkRingQueueSpinPop(b *testing.B) {
-	rq := NewRingQueue(b.N, true)
-
-	for i := 0; i < b.N; i++ {
-		err := rq.Push(i)
-		assert.Nil(b, err)
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		rq.Pop()
-	}
-}
-
-func BenchmarkRingQueueChannelPushPop(b *testing.B) {
-	rq := NewRingQueue(64, false)
-
-	var count int
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
-		for {
-			_, err := rq.Pop()
-			assert.Nil(b, err)
-
-			count++
-			if count == b.N {
-				return
-			}
-		}
-	}()
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		rq.Push(i)
-	}
-
-	wg.Wait()
-}
-
-func BenchmarkRingQueueChannelPush(b *testing.B) {
-	rq := NewRingQueue(b.N, false)
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		rq.Push(i)
-	}
-}
-
-func BenchmarkRingQueueChannelPop(b *testing.B) {
-	rq := NewRingQueue(b.N, false)
-
-	for i := 0; i < b.N; i++ {
-		err := rq.Push(i)
-		assert.Nil(b, err)
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		rq.Pop()
-	}
-}
-
-func BenchmarkRingQueueSpinParallelPushPop(b *testing.B) {
-	rq := NewRingQueue(b.N, true)
-
-	b.ResetTimer()
-	b.RunParallel(func(pb *testing.PB) {
-		i := 0
-		for pb.Next() {
-			rq.Push(i)
-			rq.Pop()
-			i++
-		}
-	})
-}
-
-func BenchmarkRingQueueSpinParallelPush(b *testing.B) {
-	rq := NewRingQueue(b.N, true)
-
-	b.ResetTimer()
-	b.RunParallel(func(pb *testing.PB) {
-		i := 0
-		for pb.Next() {
-			rq.Push(i)
-			i++
-		}
-	})
-}
-
-func BenchmarkRingQueueSpinParallelPop(b *testing.B) {
-	rq := NewRingQueue(b.N, true)
-
-	for i := 0; i < b.N; i++ {
-		err := rq.Push(i)
-		assert.Nil(b, err)
-	}
-
-	b.ResetTimer()
-	b.RunParallel(func(pb *testing.PB) {
-		for pb.Next() {
-			rq.Pop()
-		}
-	})
-}
+package queue
+
+import (
+	"context"
+	"testing"
+	"github.com/stretchr/testify/assert"
+	"time"
+	"sync"
+	"sync/atomic"
+)
+
+func TestRingQueuePushPop(t *testing.T) {
+	rq := NewRingQueue[int](8, BlockingWait{})
+
+	assert.True(t, rq.Empty())
+	assert.Zero(t, rq.Len())
+
+	err := rq.Push(1)
+	assert.Nil(t, err)
+
+	assert.False(t, rq.Empty())
+	assert.Equal(t, 1, rq.Len())
+
+	val, err := rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+
+	rq.Push(1)
+	rq.Push(2)
+
+	val, err = rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+
+	rq.Push(3)
+	rq.Push(4)
+
+	val, err = rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+
+	val, err = rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+
+	assert.False(t, rq.Empty())
+	assert.Equal(t, 1, rq.Len())
+}
+
+func TestRingQueuePeekSnapshot(t *testing.T) {
+	rq := NewRingQueue[int](4, BlockingWait{})
+
+	_, err := rq.Peek()
+	assert.Equal(t, ErrEmpty, err)
+	assert.Empty(t, rq.Snapshot())
+
+	// wrap around the ring
+	for i := 0; i < 3; i++ {
+		rq.Push(i)
+		rq.Pop()
+	}
+	for i := 1; i <= 4; i++ {
+		rq.Push(i)
+	}
+	val, err := rq.Peek()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	assert.Equal(t, 4, rq.Len())
+	assert.Equal(t, []int{1, 2, 3, 4}, rq.Snapshot())
+
+	it := rq.Iterator()
+	val, err = rq.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	assert.Equal(t, []int{2, 3, 4}, rq.Snapshot())
+	assertIterator(t, it, 1, 2, 3, 4)
+}
+
+func TestRingQueueSnapshotConcurrent(t *testing.T) {
+	const n = 2000
+	rq := NewRingQueue[int](16, BlockingWait{})
+
+	go func() {
+		for i := 0; i < n; i++ {
+			rq.Push(i)
+		}
+	}()
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// the snapshot is a run of consecutive items
+			items := rq.Snapshot()
+			for k := 1; k < len(items); k++ {
+				assert.Equal(t, items[k-1]+1, items[k])
+			}
+			rq.Peek()
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		val, err := rq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, i, val)
+	}
+	close(stop)
+}
+
+func TestRingQueueSpinNonblocking(t *testing.T) {
+	rq := NewRingQueue[int](2, BusySpinWait{})
+
+	err := rq.Push(1, 0)
+	assert.Nil(t, err)
+	err = rq.Push(2, 0)
+	assert.Nil(t, err)
+	err = rq.Push(3, 0)
+	assert.Equal(t, ErrFull, err)
+
+	val, err := rq.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	val, err = rq.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+	val, err = rq.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+	assert.Zero(t, val)
+
+	err = rq.Push(3, 0)
+	assert.Nil(t, err)
+
+	val, err = rq.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+}
+
+func TestRingQueueSpinTimeout(t *testing.T) {
+	rq := NewRingQueue[int](2, BusySpinWait{})
+
+	err := rq.Push(1)
+	assert.Nil(t, err)
+	err = rq.Push(2)
+	assert.Nil(t, err)
+	err = rq.Push(3, time.Microsecond)
+	assert.Equal(t, ErrTimeout, err)
+
+	val, err := rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	val, err = rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+	val, err = rq.Pop(time.Microsecond)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Zero(t, val)
+
+	go func() {
+		time.Sleep(2*time.Millisecond)
+		err := rq.Push(3)
+		assert.Nil(t, err)
+	}()
+
+	val, err = rq.Pop(time.Millisecond)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Zero(t, val)
+
+	val, err = rq.Pop(5*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+}
+
+func TestRingQueueSpinBlocking(t *testing.T) {
+	rq := NewRingQueue[int](2, BusySpinWait{})
+
+	err := rq.Push(1)
+	assert.Nil(t, err)
+	err = rq.Push(2)
+	assert.Nil(t, err)
+
+	go func() {
+		time.Sleep(2*time.Millisecond)
+		val, err := rq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, val)
+	}()
+
+	err = rq.Push(3)
+	assert.Nil(t, err)
+
+	val, err := rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+
+	go func() {
+		time.Sleep(2*time.Millisecond)
+		err := rq.Push(3)
+		assert.Nil(t, err)
+	}()
+
+	val, err = rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+}
+
+func TestRingQueueChannelNonblocking(t *testing.T) {
+	rq := NewRingQueue[int](2, BlockingWait{})
+
+	err := rq.Push(1, 0)
+	assert.Nil(t, err)
+	err = rq.Push(2, 0)
+	assert.Nil(t, err)
+	err = rq.Push(3, 0)
+	assert.Equal(t, ErrFull, err)
+
+	val, err := rq.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	val, err = rq.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+	val, err = rq.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+	assert.Zero(t, val)
+
+	err = rq.Push(3, 0)
+	assert.Nil(t, err)
+
+	val, err = rq.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+}
+
+func TestRingQueueChannelTimeout(t *testing.T) {
+	rq := NewRingQueue[int](2, BlockingWait{})
+
+	err := rq.Push(1)
+	assert.Nil(t, err)
+	err = rq.Push(2)
+	assert.Nil(t, err)
+	err = rq.Push(3, time.Microsecond)
+	assert.Equal(t, ErrTimeout, err)
+
+	val, err := rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	val, err = rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+	val, err = rq.Pop(time.Microsecond)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Zero(t, val)
+
+	go func() {
+		time.Sleep(2*time.Millisecond)
+		err := rq.Push(3)
+		assert.Nil(t, err)
+	}()
+
+	val, err = rq.Pop(time.Millisecond)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Zero(t, val)
+
+	val, err = rq.Pop(5*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+}
+
+func TestRingQueueChannelBlocking(t *testing.T) {
+	rq := NewRingQueue[int](2, BlockingWait{})
+
+	err := rq.Push(1)
+	assert.Nil(t, err)
+	err = rq.Push(2)
+	assert.Nil(t, err)
+
+	go func() {
+		time.Sleep(2*time.Millisecond)
+		val, err := rq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, val)
+	}()
+
+	err = rq.Push(3)
+	assert.Nil(t, err)
+
+	val, err := rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+
+	go func() {
+		time.Sleep(2*time.Millisecond)
+		err := rq.Push(3)
+		assert.Nil(t, err)
+	}()
+
+	val, err = rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+}
+
+func TestRingQueueSpinContext(t *testing.T) {
+	testRingQueueContext(t, BusySpinWait{})
+}
+
+func TestRingQueueChannelContext(t *testing.T) {
+	testRingQueueContext(t, BlockingWait{})
+}
+
+func testRingQueueContext(t *testing.T, wait WaitStrategy) {
+	rq := NewRingQueue[int](2, wait)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(2*time.Millisecond)
+		cancel()
+	}()
+	val, err := rq.PopContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+	assert.Zero(t, val)
+
+	err = rq.PushContext(context.Background(), 1)
+	assert.Nil(t, err)
+	err = rq.PushContext(context.Background(), 2)
+	assert.Nil(t, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Millisecond)
+	defer cancel()
+	err = rq.PushContext(ctx, 3)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 2, rq.Len())
+
+	go func() {
+		time.Sleep(2*time.Millisecond)
+		val, err := rq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, val)
+	}()
+	err = rq.PushContext(context.Background(), 3)
+	assert.Nil(t, err)
+
+	val, err = rq.PopContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+	val, err = rq.PopContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+}
+
+func TestRingQueueSpinClose(t *testing.T) {
+	testRingQueueClose(t, BusySpinWait{})
+}
+
+func TestRingQueueChannelClose(t *testing.T) {
+	testRingQueueClose(t, BlockingWait{})
+}
+
+func testRingQueueClose(t *testing.T, wait WaitStrategy) {
+	rq := NewRingQueue[int](2, wait)
+	assert.False(t, rq.IsClosed())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		val, err := rq.Pop()
+		assert.Equal(t, ErrClosed, err)
+		assert.Zero(t, val)
+	}()
+	time.Sleep(2*time.Millisecond)
+	rq.Close()
+	wg.Wait()
+	assert.True(t, rq.IsClosed())
+
+	rq = NewRingQueue[int](2, wait)
+	rq.Push(1)
+	rq.Push(2)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := rq.Push(3)
+		assert.Equal(t, ErrClosed, err)
+	}()
+	time.Sleep(2*time.Millisecond)
+	rq.Close()
+	rq.Close()
+	wg.Wait()
+
+	err := rq.Push(3, 0)
+	assert.Equal(t, ErrClosed, err)
+	err = rq.PushContext(context.Background(), 3)
+	assert.Equal(t, ErrClosed, err)
+
+	val, err := rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	val, err = rq.PopContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+	val, err = rq.Pop(0)
+	assert.Equal(t, ErrClosed, err)
+	assert.Zero(t, val)
+	val, err = rq.PopContext(context.Background())
+	assert.Equal(t, ErrClosed, err)
+	assert.Zero(t, val)
+}
+
+// waitFunc is a WaitStrategy that calls the function, for tests.
+type waitFunc func(attempt int, cond *WaitCond)
+
+func (f waitFunc) Wait(attempt int, cond *WaitCond) {
+	f(attempt, cond)
+}
+
+func (waitFunc) Parks() bool {
+	return false
+}
+
+func TestRingQueueRetryInFlight(t *testing.T) {
+	var rq *RingQueue[int]
+	retries := 0
+	rq = NewRingQueue[int](2, waitFunc(func(attempt int, cond *WaitCond) {
+		// the retry is not waiting for a notification
+		assert.True(t, isDone(cond.Ready))
+		assert.Equal(t, retries, attempt)
+		retries++
+		if attempt == 2 {
+			n := rq.nodes[0]
+			n.data = 7
+			atomic.StoreUint64(&n.position, 1)
+		}
+	}))
+
+	// a push has reserved the first node, but not stored its item yet
+	atomic.AddUint64(&rq.tail, 1)
+	rq.Close()
+	val, err := rq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 7, val)
+	assert.Equal(t, 3, retries)
+}
+
+func TestRingQueueSpinBatch(t *testing.T) {
+	testRingQueueBatch(t, BusySpinWait{})
+}
+
+func TestRingQueueChannelBatch(t *testing.T) {
+	testRingQueueBatch(t, BlockingWait{})
+}
+
+func testRingQueueBatch(t *testing.T, wait WaitStrategy) {
+	rq := NewRingQueue[int](4, wait)
+
+	n, err := rq.PushBatch([]int{1, 2, 3})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 3, rq.Len())
+
+	n, err = rq.PushBatch([]int{4, 5, 6}, 0)
+	assert.Equal(t, ErrFull, err)
+	assert.Equal(t, 1, n)
+
+	n, err = rq.PushBatch([]int{5}, time.Millisecond)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Equal(t, 0, n)
+
+	dst := make([]int, 3)
+	n, err = rq.PopBatch(dst)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []int{1, 2, 3}, dst)
+
+	n, err = rq.PopBatch(dst)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 4, dst[0])
+
+	n, err = rq.PopBatch(dst, 0)
+	assert.Equal(t, ErrEmpty, err)
+	assert.Equal(t, 0, n)
+	n, err = rq.PopBatch(dst, time.Millisecond)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Equal(t, 0, n)
+
+	go func() {
+		time.Sleep(2*time.Millisecond)
+		n, err := rq.PopBatch(make([]int, 4))
+		assert.Nil(t, err)
+		assert.Equal(t, 4, n)
+	}()
+	n, err = rq.PushBatch([]int{1, 2, 3, 4, 5, 6})
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+
+	n, err = rq.PopBatch(dst)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []int{5, 6}, dst[:n])
+
+	rq.Push(7)
+	rq.Close()
+	n, err = rq.PushBatch([]int{8})
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, 0, n)
+	n, err = rq.PopBatch(dst)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = rq.PopBatch(dst)
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestRingQueueSpinBatchConcurrent(t *testing.T) {
+	testRingQueueBatchConcurrent(t, BusySpinWait{})
+}
+
+func TestRingQueueChannelBatchConcurrent(t *testing.T) {
+	testRingQueueBatchConcurrent(t, BlockingWait{})
+}
+
+func testRingQueueBatchConcurrent(t *testing.T, wait WaitStrategy) {
+	const producers, batches, batchSize = 2, 50, 10
+	rq := NewRingQueue[int](16, wait)
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			items := make([]int, batchSize)
+			for b := 0; b < batches; b++ {
+				for k := range items {
+					items[k] = (p*batches+b)*batchSize + k
+				}
+				n, err := rq.PushBatch(items)
+				assert.Nil(t, err)
+				assert.Equal(t, batchSize, n)
+			}
+		}(p)
+	}
+
+	seen := make([]bool, producers*batches*batchSize)
+	var mu sync.Mutex
+	var cwg sync.WaitGroup
+	for c := 0; c < producers; c++ {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			dst := make([]int, 7)
+			for {
+				n, err := rq.PopBatch(dst)
+				if err == ErrClosed {
+					return
+				}
+				assert.Nil(t, err)
+				mu.Lock()
+				for _, v := range dst[:n] {
+					assert.False(t, seen[v])
+					seen[v] = true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	rq.Close()
+	cwg.Wait()
+	for _, ok := range seen {
+		assert.True(t, ok)
+	}
+}
+
+func BenchmarkRingQueueSpinPushPop(b *testing.B) {
+	rq := NewRingQueue[int](64, BusySpinWait{})
+
+	var count int
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		for {
+			_, err := rq.Pop()
+			assert.Nil(b, err)
+
+			count++
+			if count == b.N {
+				return
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rq.Push(i)
+	}
+
+	wg.Wait()
+}
+
+func BenchmarkRingQueueSpinPush(b *testing.B) {
+	rq := NewRingQueue[int](b.N, BusySpinWait{})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rq.Push(i)
+	}
+}
+
+func BenchmarkRingQueueSpinPop(b *testing.B) {
+	rq := NewRingQueue[int](b.N, BusySpinWait{})
+
+	for i := 0; i < b.N; i++ {
+		err := rq.Push(i)
+		assert.Nil(b, err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rq.Pop()
+	}
+}
+
+func BenchmarkRingQueueChannelPushPop(b *testing.B) {
+	rq := NewRingQueue[int](64, BlockingWait{})
+
+	var count int
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		for {
+			_, err := rq.Pop()
+			assert.Nil(b, err)
+
+			count++
+			if count == b.N {
+				return
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rq.Push(i)
+	}
+
+	wg.Wait()
+}
+
+func BenchmarkRingQueueChannelPush(b *testing.B) {
+	rq := NewRingQueue[int](b.N, BlockingWait{})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rq.Push(i)
+	}
+}
+
+func BenchmarkRingQueueChannelPop(b *testing.B) {
+	rq := NewRingQueue[int](b.N, BlockingWait{})
+
+	for i := 0; i < b.N; i++ {
+		err := rq.Push(i)
+		assert.Nil(b, err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rq.Pop()
+	}
+}
+
+func BenchmarkRingQueueSpinParallelPushPop(b *testing.B) {
+	rq := NewRingQueue[int](b.N, BusySpinWait{})
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			rq.Push(i)
+			rq.Pop()
+			i++
+		}
+	})
+}
+
+func BenchmarkRingQueueSpinParallelPush(b *testing.B) {
+	rq := NewRingQueue[int](b.N, BusySpinWait{})
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			rq.Push(i)
+			i++
+		}
+	})
+}
+
+func BenchmarkRingQueueSpinParallelPop(b *testing.B) {
+	rq := NewRingQueue[int](b.N, BusySpinWait{})
+
+	for i := 0; i < b.N; i++ {
+		err := rq.Push(i)
+		assert.Nil(b, err)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rq.Pop()
+		}
+	})
+}
+
+func BenchmarkRingQueueSpinPushPopBatch(b *testing.B) {
+	benchmarkRingQueuePushPopBatch(b, BusySpinWait{}, 64)
+}
+
+func BenchmarkRingQueueChannelPushPopBatch(b *testing.B) {
+	benchmarkRingQueuePushPopBatch(b, BlockingWait{}, 64)
+}
+
+func benchmarkRingQueuePushPopBatch(b *testing.B, wait WaitStrategy, batchSize int) {
+	rq := NewRingQueue[int](1024, wait)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		dst := make([]int, batchSize)
+		for count := 0; count < b.N; {
+			n, err := rq.PopBatch(dst)
+			assert.Nil(b, err)
+			count += n
+		}
+	}()
+
+	items := make([]int, batchSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i += batchSize {
+		if b.N-i < batchSize {
+			items = items[:b.N-i]
+		}
+		rq.PushBatch(items)
+	}
+
+	wg.Wait()
+}
+
+func BenchmarkRingQueueSpinPushBatch(b *testing.B) {
+	rq := NewRingQueue[int](b.N, BusySpinWait{})
+	items := make([]int, 64)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i += len(items) {
+		if b.N-i < len(items) {
+			items = items[:b.N-i]
+		}
+		rq.PushBatch(items)
+	}
+}
+
+func BenchmarkRingQueueSpinPopBatch(b *testing.B) {
+	rq := NewRingQueue[int](b.N, BusySpinWait{})
+
+	for i := 0; i < b.N; i++ {
+		err := rq.Push(i)
+		assert.Nil(b, err)
+	}
+
+	dst := make([]int, 64)
+	b.ResetTimer()
+	for i := 0; i < b.N; i += len(dst) {
+		rq.PopBatch(dst)
+	}
+}
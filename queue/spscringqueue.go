@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SPSCRingQueue is a bounded ring buffer queue for a single producer and
+// a single consumer: Push must not be called concurrently with another
+// Push, nor Pop with another Pop. In exchange, it needs no CAS at all, each
+// side caches the index of the other to touch its cache line only when it
+// must, and the items are stored contiguously.
+type SPSCRingQueue[T any] struct {
+	padding0   [8]uint64
+	tail       uint64 // written by the producer only
+	cachedHead uint64 // the producer's view of head
+	padding1   [8]uint64
+	head       uint64 // written by the consumer only
+	cachedTail uint64 // the consumer's view of tail
+	padding2   [8]uint64
+	mask       uint64
+	items      []T
+	strategy   WaitStrategy
+	signal     bool
+	notFull    chan struct{}
+	notEmpty   chan struct{}
+	done       chan struct{}
+	closed     atomic.Bool
+	closer     sync.Once
+}
+
+// NewSPSCRingQueue will allocate a SPSCRingQueue with the specified capacity.
+// The `strategy` specifies how an operation waits when it will be blocked,
+// as for NewRingQueue.
+func NewSPSCRingQueue[T any](capacity int, strategy WaitStrategy) *SPSCRingQueue[T] {
+	if capacity == 0 {
+		panic("SPSCRingQueue capacity must be greater than 0")
+	}
+	n := roundUp(uint64(capacity))
+
+	return &SPSCRingQueue[T]{
+		items:    make([]T, n),
+		mask:     n - 1,
+		strategy: strategy,
+		signal:   strategy.Parks(),
+		notFull:  make(chan struct{}, 1),
+		notEmpty: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// Push adds the item to the queue. If the queue is full, will block
+// until an item is removed from the queue. If a nonzero timeout is specified,
+// block no more than the timeout duration and return ErrTimeout. If timeout
+// is zero, immediately return ErrFull. If the queue is closed, return ErrClosed.
+func (sq *SPSCRingQueue[T]) Push(item T, timeout ...time.Duration) error {
+	return sq.push(context.Background(), item, timeout...)
+}
+
+// PushContext adds the item to the queue. If the queue is full, will block
+// until an item is removed from the queue or ctx is done, in which case
+// ctx.Err() is returned. If the queue is closed, return ErrClosed.
+func (sq *SPSCRingQueue[T]) PushContext(ctx context.Context, item T) error {
+	return sq.push(ctx, item)
+}
+
+func (sq *SPSCRingQueue[T]) push(ctx context.Context, item T, timeout ...time.Duration) error {
+	if sq.closed.Load() {
+		return ErrClosed
+	}
+	tail := sq.tail
+	if tail-sq.cachedHead > sq.mask {
+		sq.cachedHead = atomic.LoadUint64(&sq.head)
+		if tail-sq.cachedHead > sq.mask { // queue is full
+			w := newWaiter(ctx, timeout)
+			for tail-sq.cachedHead > sq.mask {
+				if sq.closed.Load() {
+					return ErrClosed
+				}
+				if err := w.wait(sq.strategy, sq.notFull, sq.done, ErrFull); err != nil {
+					return err
+				}
+				sq.cachedHead = atomic.LoadUint64(&sq.head)
+			}
+		}
+	}
+
+	sq.items[tail&sq.mask] = item
+	atomic.StoreUint64(&sq.tail, tail+1)
+	if sq.signal {
+		notify(sq.notEmpty)
+	}
+	return nil
+}
+
+// Pop will return the next item in the queue. If the queue is empty,
+// block until an item can be returned. If a nonzero timeout is specified,
+// block no more than the timeout duration and return ErrTimeout. If timeout
+// is zero, immediately return ErrEmpty. Once the queue is closed, the
+// remaining items are still returned, after which ErrClosed is returned.
+func (sq *SPSCRingQueue[T]) Pop(timeout ...time.Duration) (T, error) {
+	return sq.pop(context.Background(), timeout...)
+}
+
+// PopContext will return the next item in the queue. If the queue is empty,
+// block until an item can be returned or ctx is done, in which case
+// ctx.Err() is returned. Once the queue is closed, the remaining items
+// are still returned, after which ErrClosed is returned.
+func (sq *SPSCRingQueue[T]) PopContext(ctx context.Context) (T, error) {
+	return sq.pop(ctx)
+}
+
+func (sq *SPSCRingQueue[T]) pop(ctx context.Context, timeout ...time.Duration) (T, error) {
+	var zero T
+	head := sq.head
+	if head == sq.cachedTail {
+		sq.cachedTail = atomic.LoadUint64(&sq.tail)
+		if head == sq.cachedTail { // queue is empty
+			w := newWaiter(ctx, timeout)
+			for head == sq.cachedTail {
+				if sq.closed.Load() {
+					// a push may have completed just before the close
+					if sq.cachedTail = atomic.LoadUint64(&sq.tail); head != sq.cachedTail {
+						break
+					}
+					return zero, ErrClosed
+				}
+				if err := w.wait(sq.strategy, sq.notEmpty, sq.done, ErrEmpty); err != nil {
+					return zero, err
+				}
+				sq.cachedTail = atomic.LoadUint64(&sq.tail)
+			}
+		}
+	}
+
+	item := sq.items[head&sq.mask]
+	sq.items[head&sq.mask] = zero
+	atomic.StoreUint64(&sq.head, head+1)
+	if sq.signal {
+		notify(sq.notFull)
+	}
+	return item, nil
+}
+
+// Close closes the queue and wakes up the blocked producer and consumer.
+// Further pushes return ErrClosed, while pops keep returning the remaining
+// items until the queue is drained. Close is idempotent.
+func (sq *SPSCRingQueue[T]) Close() {
+	sq.closer.Do(func() {
+		sq.closed.Store(true)
+		close(sq.done)
+	})
+}
+
+// IsClosed reports whether the queue has been closed.
+func (sq *SPSCRingQueue[T]) IsClosed() bool {
+	return sq.closed.Load()
+}
+
+// Len returns the number of items in the queue.
+func (sq *SPSCRingQueue[T]) Len() int {
+	return int(atomic.LoadUint64(&sq.tail) - atomic.LoadUint64(&sq.head))
+}
+
+// Empty returns whether the queue is empty.
+func (sq *SPSCRingQueue[T]) Empty() bool {
+	return atomic.LoadUint64(&sq.tail) == atomic.LoadUint64(&sq.head)
+}
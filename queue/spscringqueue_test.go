@@ -0,0 +1,227 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSPSCRingQueuePushPop(t *testing.T) {
+	sq := NewSPSCRingQueue[int](2, BlockingWait{})
+
+	assert.True(t, sq.Empty())
+	assert.Zero(t, sq.Len())
+
+	assert.Nil(t, sq.Push(1, 0))
+	assert.Nil(t, sq.Push(2, 0))
+	assert.Equal(t, ErrFull, sq.Push(3, 0))
+	assert.Equal(t, ErrTimeout, sq.Push(3, time.Millisecond))
+	assert.Equal(t, 2, sq.Len())
+
+	val, err := sq.Pop(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	assert.Nil(t, sq.Push(3, 0))
+
+	val, err = sq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+	val, err = sq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+
+	val, err = sq.Pop(0)
+	assert.Equal(t, ErrEmpty, err)
+	assert.Zero(t, val)
+	val, err = sq.Pop(time.Millisecond)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Zero(t, val)
+	assert.True(t, sq.Empty())
+}
+
+func TestSPSCRingQueueSpinBlocking(t *testing.T) {
+	testSPSCRingQueueBlocking(t, BusySpinWait{})
+}
+
+func TestSPSCRingQueueChannelBlocking(t *testing.T) {
+	testSPSCRingQueueBlocking(t, BlockingWait{})
+}
+
+func testSPSCRingQueueBlocking(t *testing.T, wait WaitStrategy) {
+	sq := NewSPSCRingQueue[int](1, wait)
+	sq.Push(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, sq.PushContext(ctx, 2))
+
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		val, err := sq.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, val)
+	}()
+	assert.Nil(t, sq.PushContext(context.Background(), 2))
+
+	val, err := sq.PopContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, val)
+
+	go func() {
+		time.Sleep(2 * time.Millisecond)
+		assert.Nil(t, sq.Push(3))
+	}()
+	val, err = sq.PopContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, val)
+}
+
+func TestSPSCRingQueueClose(t *testing.T) {
+	sq := NewSPSCRingQueue[int](1, BlockingWait{})
+	assert.False(t, sq.IsClosed())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		val, err := sq.Pop()
+		assert.Equal(t, ErrClosed, err)
+		assert.Zero(t, val)
+	}()
+	time.Sleep(2 * time.Millisecond)
+	sq.Close()
+	wg.Wait()
+	assert.True(t, sq.IsClosed())
+
+	sq = NewSPSCRingQueue[int](1, BlockingWait{})
+	sq.Push(1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Equal(t, ErrClosed, sq.Push(2))
+	}()
+	time.Sleep(2 * time.Millisecond)
+	sq.Close()
+	sq.Close()
+	wg.Wait()
+
+	val, err := sq.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	val, err = sq.Pop()
+	assert.Equal(t, ErrClosed, err)
+	assert.Zero(t, val)
+}
+
+func TestSPSCRingQueueWaitStrategies(t *testing.T) {
+	for name, wait := range waitStrategies {
+		t.Run(name, func(t *testing.T) {
+			testSPSCRingQueueBlocking(t, wait)
+			testSPSCRingQueueConcurrent(t, wait)
+		})
+	}
+}
+
+func testSPSCRingQueueConcurrent(t *testing.T, wait WaitStrategy) {
+	const items = 2000
+	sq := NewSPSCRingQueue[int](16, wait)
+
+	go func() {
+		for i := 0; i < items; i++ {
+			assert.Nil(t, sq.Push(i))
+		}
+		sq.Close()
+	}()
+
+	for i := 0; ; i++ {
+		val, err := sq.Pop()
+		if err == ErrClosed {
+			assert.Equal(t, items, i)
+			break
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, i, val)
+	}
+}
+
+func BenchmarkSPSCRingQueueSpinPushPop(b *testing.B) {
+	sq := NewSPSCRingQueue[int](64, BusySpinWait{})
+
+	var count int
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		for {
+			_, err := sq.Pop()
+			assert.Nil(b, err)
+
+			count++
+			if count == b.N {
+				return
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sq.Push(i)
+	}
+
+	wg.Wait()
+}
+
+func BenchmarkSPSCRingQueueChannelPushPop(b *testing.B) {
+	sq := NewSPSCRingQueue[int](64, BlockingWait{})
+
+	var count int
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		for {
+			_, err := sq.Pop()
+			assert.Nil(b, err)
+
+			count++
+			if count == b.N {
+				return
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sq.Push(i)
+	}
+
+	wg.Wait()
+}
+
+func BenchmarkSPSCRingQueueSpinPush(b *testing.B) {
+	sq := NewSPSCRingQueue[int](b.N, BusySpinWait{})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sq.Push(i)
+	}
+}
+
+func BenchmarkSPSCRingQueueSpinPop(b *testing.B) {
+	sq := NewSPSCRingQueue[int](b.N, BusySpinWait{})
+
+	for i := 0; i < b.N; i++ {
+		err := sq.Push(i)
+		assert.Nil(b, err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sq.Pop()
+	}
+}
@@ -0,0 +1,261 @@
+package queue
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// WaitStrategy determines how a RingQueue operation waits while the queue
+// is full (for pushes) or empty (for pops).
+type WaitStrategy interface {
+	// Wait is called each time an operation finds that it cannot proceed,
+	// and returns when the operation is worth retrying. The attempt counts
+	// the previous calls for the same operation, starting at 0.
+	//
+	// Wait is also called when an operation retries after losing a race to
+	// another one, with a cond whose Ready is always ready, and its own count
+	// of attempts, so that contended operations back off as the strategy does.
+	Wait(attempt int, cond *WaitCond)
+
+	// Parks reports whether Wait may block on cond.Ready. The queue only
+	// pays for notifying waiters after each operation if it does.
+	Parks() bool
+}
+
+// WaitCond describes what a blocked RingQueue operation is waiting for.
+type WaitCond struct {
+	// Ready is notified when the operation may be able to proceed.
+	Ready <-chan struct{}
+	// Cancel is closed when the operation is cancelled; nil if it cannot be.
+	Cancel <-chan struct{}
+	// Closed is closed when the queue is closed.
+	Closed <-chan struct{}
+	// Deadline is the time the operation times out, or zero if it never does.
+	Deadline time.Time
+}
+
+// Park blocks until Ready is notified, the operation is cancelled, the queue
+// is closed or the deadline passes. If max is positive, Park blocks no more
+// than max.
+func (cond *WaitCond) Park(max time.Duration) {
+	if !cond.Deadline.IsZero() {
+		if d := time.Until(cond.Deadline); max <= 0 || d < max {
+			max = d
+		}
+		if max <= 0 {
+			return
+		}
+	}
+
+	if max <= 0 {
+		select {
+		case <-cond.Ready:
+		case <-cond.Cancel:
+		case <-cond.Closed:
+		}
+		return
+	}
+
+	timer := time.NewTimer(max)
+	defer timer.Stop()
+	select {
+	case <-cond.Ready:
+	case <-cond.Cancel:
+	case <-cond.Closed:
+	case <-timer.C:
+	}
+}
+
+// BusySpinWait retries immediately, burning a cpu for the lowest latency.
+// It suits dedicated cores where producers and consumers are never descheduled.
+// It only yields the processor every 10000 attempts, whether waiting or
+// retrying after a lost race, so that it cannot starve the goroutine it waits
+// for when cpus are scarce.
+type BusySpinWait struct{}
+
+func (BusySpinWait) Wait(attempt int, cond *WaitCond) {
+	if attempt%10000 == 9999 {
+		runtime.Gosched() // free up the cpu before the next iteration
+	}
+}
+
+func (BusySpinWait) Parks() bool {
+	return false
+}
+
+// YieldingWait spins for SpinTries attempts, then yields the processor to
+// other goroutines before each retry. Zero SpinTries defaults to 100.
+type YieldingWait struct {
+	SpinTries int
+}
+
+func (w YieldingWait) Wait(attempt int, cond *WaitCond) {
+	spinTries := w.SpinTries
+	if spinTries == 0 {
+		spinTries = 100
+	}
+	if attempt >= spinTries {
+		runtime.Gosched()
+	}
+}
+
+func (YieldingWait) Parks() bool {
+	return false
+}
+
+// BackoffWait spins for SpinTries attempts, then sleeps for exponentially
+// growing durations starting at MinBackoff, and parks until notified once the
+// backoff would exceed MaxBackoff. Zero fields default to 100 spins, 1µs and 1ms.
+type BackoffWait struct {
+	SpinTries  int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func (w BackoffWait) Wait(attempt int, cond *WaitCond) {
+	spinTries, minBackoff, maxBackoff := w.SpinTries, w.MinBackoff, w.MaxBackoff
+	if spinTries == 0 {
+		spinTries = 100
+	}
+	if minBackoff == 0 {
+		minBackoff = time.Microsecond
+	}
+	if maxBackoff == 0 {
+		maxBackoff = time.Millisecond
+	}
+
+	if attempt < spinTries {
+		return
+	}
+
+	backoff := minBackoff
+	for i := spinTries; i < attempt && backoff <= maxBackoff; i++ {
+		backoff <<= 1
+	}
+	if backoff > maxBackoff {
+		cond.Park(0)
+		return
+	}
+	if !cond.Deadline.IsZero() {
+		if d := time.Until(cond.Deadline); d < backoff {
+			backoff = d
+		}
+	}
+	time.Sleep(backoff)
+}
+
+func (BackoffWait) Parks() bool {
+	return true
+}
+
+// TimedParkWait parks until notified, but for no more than Timeout each time,
+// which bounds the latency of a missed notification. Zero Timeout defaults to 1ms.
+type TimedParkWait struct {
+	Timeout time.Duration
+}
+
+func (w TimedParkWait) Wait(attempt int, cond *WaitCond) {
+	timeout := w.Timeout
+	if timeout == 0 {
+		timeout = time.Millisecond
+	}
+	cond.Park(timeout)
+}
+
+func (TimedParkWait) Parks() bool {
+	return true
+}
+
+// BlockingWait parks until notified, using no cpu while waiting.
+type BlockingWait struct{}
+
+func (BlockingWait) Wait(attempt int, cond *WaitCond) {
+	cond.Park(0)
+}
+
+func (BlockingWait) Parks() bool {
+	return true
+}
+
+// waiter tracks how a single operation of a queue waits.
+type waiter struct {
+	ctx       context.Context
+	deadline  time.Time
+	noWait    bool
+	attempt   int
+	cond      *WaitCond
+	contended int // retries after losing a race
+	raceCond  *WaitCond
+}
+
+// alwaysReady is a closed channel, for the Ready of a lost race.
+var alwaysReady = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+func newWaiter(ctx context.Context, timeout []time.Duration) waiter {
+	w := waiter{ctx: ctx}
+	if len(timeout) > 0 {
+		if timeout[0] > 0 {
+			w.deadline = time.Now().Add(timeout[0])
+		} else {
+			w.noWait = true
+		}
+	}
+	return w
+}
+
+// wait blocks an operation that cannot proceed, because the queue is full
+// or empty, until it is worth retrying as decided by the wait strategy.
+// With a zero timeout, immediately return errNoWait; return ErrTimeout once
+// the timeout has elapsed, or ctx.Err() once ctx is done. A nil error means
+// the operation should retry.
+func (w *waiter) wait(strategy WaitStrategy, ready, closed chan struct{}, errNoWait error) error {
+	if w.noWait {
+		return errNoWait
+	}
+	if !w.deadline.IsZero() && !time.Now().Before(w.deadline) {
+		return ErrTimeout
+	}
+	done := w.ctx.Done()
+	if isDone(done) {
+		return w.ctx.Err()
+	}
+	if w.cond == nil {
+		w.cond = &WaitCond{
+			Ready:    ready,
+			Cancel:   done,
+			Closed:   closed,
+			Deadline: w.deadline,
+		}
+	}
+	strategy.Wait(w.attempt, w.cond)
+	w.attempt++
+	return nil
+}
+
+// retry backs off an operation that lost a race to another one, or waits
+// for one in flight, as decided by the wait strategy.
+func (w *waiter) retry(strategy WaitStrategy, closed chan struct{}) {
+	if w.raceCond == nil {
+		w.raceCond = &WaitCond{
+			Ready:    alwaysReady,
+			Cancel:   w.ctx.Done(),
+			Closed:   closed,
+			Deadline: w.deadline,
+		}
+	}
+	strategy.Wait(w.contended, w.raceCond)
+	w.contended++
+}
+
+// notify wakes up an operation waiting on ch, if any.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
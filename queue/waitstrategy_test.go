@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var waitStrategies = map[string]WaitStrategy{
+	"BusySpin":  BusySpinWait{},
+	"Yielding":  YieldingWait{},
+	"Backoff":   BackoffWait{SpinTries: 10, MaxBackoff: 100 * time.Microsecond},
+	"TimedPark": TimedParkWait{Timeout: 100 * time.Microsecond},
+	"Blocking":  BlockingWait{},
+}
+
+func TestRingQueueWaitStrategies(t *testing.T) {
+	for name, wait := range waitStrategies {
+		t.Run(name, func(t *testing.T) {
+			testRingQueueContext(t, wait)
+			testRingQueueClose(t, wait)
+			testRingQueueBatch(t, wait)
+			testRingQueueBatchConcurrent(t, wait)
+		})
+	}
+}
+
+func TestWaitCondPark(t *testing.T) {
+	ready := make(chan struct{}, 1)
+	closed := make(chan struct{})
+	cond := &WaitCond{Ready: ready, Closed: closed}
+
+	ready <- struct{}{}
+	cond.Park(0)
+	assert.Empty(t, ready)
+
+	start := time.Now()
+	cond.Park(time.Millisecond)
+	assert.True(t, time.Since(start) >= time.Millisecond)
+
+	cond.Deadline = time.Now().Add(time.Millisecond)
+	cond.Park(0)
+	assert.False(t, time.Now().Before(cond.Deadline))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cond = &WaitCond{Ready: ready, Cancel: ctx.Done(), Closed: closed}
+	go func() {
+		time.Sleep(time.Millisecond)
+		cancel()
+	}()
+	cond.Park(0)
+	assert.NotNil(t, ctx.Err())
+
+	go func() {
+		time.Sleep(time.Millisecond)
+		close(closed)
+	}()
+	cond = &WaitCond{Ready: ready, Closed: closed}
+	cond.Park(0)
+	assert.True(t, isDone(closed))
+}
@@ -0,0 +1,141 @@
+package queue
+
+import (
+	"sync/atomic"
+)
+
+// minStealCapacity is the initial capacity of the circular array of a
+// WorkStealingDeque. It must be a power of 2.
+const minStealCapacity = 32
+
+// WorkStealingDeque is an unbounded deque for work-stealing schedulers,
+// after Chase and Lev. Its owner pushes and pops items at the bottom,
+// while any number of thieves concurrently steal items from the top.
+// Push and Pop must only be called by the owner goroutine, Steal by any.
+// All operations are lock-free, and the circular array grows as needed.
+type WorkStealingDeque[T any] struct {
+	padding0 [8]uint64
+	top      atomic.Int64 // the next index to steal
+	padding1 [8]uint64
+	bottom   atomic.Int64 // the next index to push, owned by the owner
+	padding2 [8]uint64
+	array    atomic.Pointer[stealarray[T]]
+}
+
+// stealarray is a circular array of a WorkStealingDeque. Its slots are
+// accessed atomically, as a thief may read one while the owner, having
+// wrapped around, writes it, in which case the thief fails to steal.
+type stealarray[T any] struct {
+	mask  int64
+	slots []atomic.Pointer[T]
+}
+
+func newStealArray[T any](capacity int64) *stealarray[T] {
+	return &stealarray[T]{
+		mask:  capacity - 1,
+		slots: make([]atomic.Pointer[T], capacity),
+	}
+}
+
+func (a *stealarray[T]) get(i int64) *T {
+	return a.slots[i&a.mask].Load()
+}
+
+func (a *stealarray[T]) put(i int64, item *T) {
+	a.slots[i&a.mask].Store(item)
+}
+
+// grow returns an array twice as large with the items from top to bottom.
+func (a *stealarray[T]) grow(top, bottom int64) *stealarray[T] {
+	b := newStealArray[T]((a.mask + 1) << 1)
+	for i := top; i < bottom; i++ {
+		b.put(i, a.get(i))
+	}
+	return b
+}
+
+// NewWorkStealingDeque will allocate a WorkStealingDeque. If a sizeHint is
+// specified, room for that many items is allocated up front.
+func NewWorkStealingDeque[T any](sizeHint ...int) *WorkStealingDeque[T] {
+	capacity := uint64(minStealCapacity)
+	if len(sizeHint) > 0 && sizeHint[0] > minStealCapacity {
+		capacity = roundUp(uint64(sizeHint[0]))
+	}
+	d := &WorkStealingDeque[T]{}
+	d.array.Store(newStealArray[T](int64(capacity)))
+	return d
+}
+
+// Push adds the item to the bottom of the deque. Only the owner may push.
+func (d *WorkStealingDeque[T]) Push(item T) {
+	b := d.bottom.Load()
+	t := d.top.Load()
+	a := d.array.Load()
+	if b-t > a.mask { // array is full
+		a = a.grow(t, b)
+		d.array.Store(a)
+	}
+	a.put(b, &item)
+	d.bottom.Store(b + 1)
+}
+
+// Pop removes and returns the item at the bottom of the deque, i.e. the
+// most recently pushed one, or returns ErrEmpty if the deque is empty.
+// Only the owner may pop.
+func (d *WorkStealingDeque[T]) Pop() (T, error) {
+	var zero T
+	b := d.bottom.Load() - 1
+	a := d.array.Load()
+	d.bottom.Store(b) // reserve the bottom item before looking at top
+	t := d.top.Load()
+	if t > b { // deque is empty
+		d.bottom.Store(b + 1)
+		return zero, ErrEmpty
+	}
+
+	item := a.get(b)
+	if t == b {
+		// the last item, which a thief may be stealing as well
+		won := d.top.CompareAndSwap(t, t+1)
+		d.bottom.Store(b + 1)
+		if !won {
+			return zero, ErrEmpty
+		}
+	} else {
+		a.put(b, nil)
+	}
+	return *item, nil
+}
+
+// Steal removes and returns the item at the top of the deque, i.e. the
+// least recently pushed one, or returns ErrEmpty if the deque is empty.
+// It may be called concurrently by any goroutine.
+func (d *WorkStealingDeque[T]) Steal() (T, error) {
+	var zero T
+	for {
+		t := d.top.Load()
+		b := d.bottom.Load()
+		if t >= b { // deque is empty
+			return zero, ErrEmpty
+		}
+		item := d.array.Load().get(t)
+		if d.top.CompareAndSwap(t, t+1) {
+			return *item, nil
+		}
+		// another steal or the owner's pop took the item
+	}
+}
+
+// Len returns the number of items in the deque. Under concurrent
+// operations it is only a snapshot.
+func (d *WorkStealingDeque[T]) Len() int {
+	if n := d.bottom.Load() - d.top.Load(); n > 0 {
+		return int(n)
+	}
+	return 0
+}
+
+// Empty returns whether the deque is empty.
+func (d *WorkStealingDeque[T]) Empty() bool {
+	return d.Len() == 0
+}
@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkStealingDequePushPopSteal(t *testing.T) {
+	d := NewWorkStealingDeque[int]()
+
+	assert.True(t, d.Empty())
+	_, err := d.Pop()
+	assert.Equal(t, ErrEmpty, err)
+	_, err = d.Steal()
+	assert.Equal(t, ErrEmpty, err)
+
+	// grow the array a few times
+	for i := 0; i < 200; i++ {
+		d.Push(i)
+	}
+	assert.Equal(t, 200, d.Len())
+
+	// the owner pops the newest items, thieves steal the oldest
+	for i := 0; i < 100; i++ {
+		val, err := d.Steal()
+		assert.Nil(t, err)
+		assert.Equal(t, i, val)
+
+		val, err = d.Pop()
+		assert.Nil(t, err)
+		assert.Equal(t, 199-i, val)
+	}
+	assert.True(t, d.Empty())
+	_, err = d.Pop()
+	assert.Equal(t, ErrEmpty, err)
+
+	d.Push(1)
+	val, err := d.Steal()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, val)
+	_, err = d.Pop()
+	assert.Equal(t, ErrEmpty, err)
+}
+
+func TestWorkStealingDequeConcurrent(t *testing.T) {
+	const thieves, n = 4, 10000
+	d := NewWorkStealingDeque[int](4)
+	seen := make([][]int, thieves+1)
+
+	var done sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < thieves; i++ {
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			for {
+				val, err := d.Steal()
+				if err == nil {
+					seen[i] = append(seen[i], val)
+					continue
+				}
+				select {
+				case <-stop:
+					return
+				default:
+				}
+			}
+		}(i)
+	}
+
+	// the owner pops an item for every two it pushes
+	for i := 0; i < n; i++ {
+		d.Push(i)
+		if i%2 == 1 {
+			if val, err := d.Pop(); err == nil {
+				seen[thieves] = append(seen[thieves], val)
+			}
+		}
+	}
+	for {
+		val, err := d.Pop()
+		if err != nil {
+			break
+		}
+		seen[thieves] = append(seen[thieves], val)
+	}
+	close(stop)
+	done.Wait()
+
+	// every item is taken exactly once
+	counts := make([]int, n)
+	for _, vals := range seen {
+		for _, val := range vals {
+			counts[val]++
+		}
+	}
+	for i, count := range counts {
+		assert.Equal(t, 1, count, "item %d", i)
+	}
+}
+
+func BenchmarkWorkStealingDequePushPop(b *testing.B) {
+	d := NewWorkStealingDeque[int]()
+	for i := 0; i < b.N; i++ {
+		d.Push(i)
+		d.Pop()
+	}
+}
+
+func BenchmarkWorkStealingDequeSteal(b *testing.B) {
+	d := NewWorkStealingDeque[int](b.N)
+	for i := 0; i < b.N; i++ {
+		d.Push(i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			d.Steal()
+		}
+	})
+}